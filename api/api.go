@@ -46,6 +46,11 @@ type Server struct {
 	aggrDur time.Duration
 	server  *http.Server
 	cmdLine string
+	// metrics are updated with every operation while the benchmark is running.
+	metrics *metrics
+	// live contains the subscribers of live streams.
+	live   map[*liveSubscriber]struct{}
+	liveMu sync.Mutex
 
 	// Shutting down
 	ctx    context.Context
@@ -249,12 +254,15 @@ func NewBenchmarkMonitor(listenAddr string) *Server {
 	}
 
 	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.metrics = newMetrics()
 	mux := http.NewServeMux()
 	mux.HandleFunc("/v1/stop", s.handleStop)
 	mux.HandleFunc("/v1/status", s.handleStatus)
 	mux.HandleFunc("/v1/aggregated", s.handleAggregated)
 	mux.HandleFunc("/v1/operations/json", s.handleDownloadJSON)
 	mux.HandleFunc("/v1/operations", s.handleDownloadZst)
+	mux.HandleFunc("/v1/live", s.handleLive)
+	mux.HandleFunc("/metrics", s.handleMetrics)
 
 	s.server = &http.Server{
 		Addr:              listenAddr,
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"stress/pkg/bench"
+
+	"github.com/minio/websocket"
+)
+
+const (
+	// Limits of the segment duration of live streams.
+	liveMinSegment = 100 * time.Millisecond
+	liveMaxSegment = time.Minute
+	// liveWriteTimeout is the time allowed to send a segment to a client.
+	liveWriteTimeout = 10 * time.Second
+)
+
+// LiveOp contains the operations of a single type completed in a segment of a running benchmark.
+type LiveOp struct {
+	Type      string  `json:"type"`
+	Ops       int64   `json:"ops"`
+	Errors    int64   `json:"errors"`
+	Objects   int64   `json:"objects"`
+	Bytes     int64   `json:"bytes"`
+	BPS       float64 `json:"bytes_per_sec"`
+	OPS       float64 `json:"obj_per_sec"`
+	P50Millis float64 `json:"p50_millis"`
+	P90Millis float64 `json:"p90_millis"`
+	P99Millis float64 `json:"p99_millis"`
+	MaxMillis float64 `json:"max_millis"`
+}
+
+// LiveSegment contains the operations completed in a segment of a running benchmark.
+type LiveSegment struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Operations sorted by type.
+	Operations []LiveOp `json:"operations"`
+	// Status is the last status of the benchmark.
+	Status string `json:"status"`
+	// DataReady is set when the benchmark has finished. It is the last segment sent.
+	DataReady bool `json:"data_ready"`
+}
+
+// liveOpTotals contains the operations of a single type completed in the current segment.
+type liveOpTotals struct {
+	ops, errors, objects, bytes int64
+	durs                        []time.Duration
+}
+
+// liveSubscriber aggregates the operations for a single live stream.
+type liveSubscriber struct {
+	mu    sync.Mutex
+	start time.Time
+	ops   map[string]*liveOpTotals
+}
+
+func newLiveSubscriber() *liveSubscriber {
+	return &liveSubscriber{start: time.Now(), ops: make(map[string]*liveOpTotals)}
+}
+
+func (l *liveSubscriber) add(op bench.Operation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t := l.ops[op.OpType]
+	if t == nil {
+		t = &liveOpTotals{}
+		l.ops[op.OpType] = t
+	}
+	t.ops++
+	if op.Err != "" {
+		t.errors++
+	} else {
+		t.durs = append(t.durs, op.Duration())
+	}
+	t.objects += int64(op.ObjPerOp)
+	t.bytes += op.Size
+}
+
+// rollover ends the current segment at now and returns it.
+func (l *liveSubscriber) rollover(now time.Time) LiveSegment {
+	l.mu.Lock()
+	seg := LiveSegment{Start: l.start, End: now, Operations: make([]LiveOp, 0, len(l.ops))}
+	ops := l.ops
+	l.ops = make(map[string]*liveOpTotals, len(ops))
+	l.start = now
+	l.mu.Unlock()
+
+	secs := now.Sub(seg.Start).Seconds()
+	millis := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	for typ, t := range ops {
+		op := LiveOp{Type: typ, Ops: t.ops, Errors: t.errors, Objects: t.objects, Bytes: t.bytes}
+		if secs > 0 {
+			op.BPS = float64(t.bytes) / secs
+			op.OPS = float64(t.objects) / secs
+		}
+		if n := len(t.durs); n > 0 {
+			sort.Slice(t.durs, func(i, j int) bool { return t.durs[i] < t.durs[j] })
+			op.P50Millis = millis(t.durs[n*50/100])
+			op.P90Millis = millis(t.durs[n*90/100])
+			op.P99Millis = millis(t.durs[n*99/100])
+			op.MaxMillis = millis(t.durs[n-1])
+		}
+		seg.Operations = append(seg.Operations, op)
+	}
+	sort.Slice(seg.Operations, func(i, j int) bool { return seg.Operations[i].Type < seg.Operations[j].Type })
+	return seg
+}
+
+// subscribeLive returns a subscriber that receives operations until unsubscribed.
+func (s *Server) subscribeLive() (l *liveSubscriber, unsubscribe func()) {
+	l = newLiveSubscriber()
+	s.liveMu.Lock()
+	if s.live == nil {
+		s.live = make(map[*liveSubscriber]struct{})
+	}
+	s.live[l] = struct{}{}
+	s.liveMu.Unlock()
+	return l, func() {
+		s.liveMu.Lock()
+		delete(s.live, l)
+		s.liveMu.Unlock()
+	}
+}
+
+// observeLive adds a completed operation to all live streams.
+func (s *Server) observeLive(op bench.Operation) {
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+	for l := range s.live {
+		l.add(op)
+	}
+}
+
+// handleLive handles GET `/v1/live` requests with optional "segment" parameter.
+// Every segment the operations completed in it are aggregated and sent,
+// as Server-Sent Events or, if the client requests an upgrade, as websocket JSON messages.
+// The stream ends with a segment with data_ready set once the benchmark has finished.
+func (s *Server) handleLive(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	segmentDur := time.Second
+	if p := req.URL.Query().Get("segment"); p != "" {
+		var err error
+		segmentDur, err = time.ParseDuration(p)
+		if err == nil && (segmentDur < liveMinSegment || segmentDur > liveMaxSegment) {
+			err = fmt.Errorf("segment must be between %v and %v", liveMinSegment, liveMaxSegment)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	}
+	// Subscribe before responding, so operations completed after the client is connected are included.
+	l, unsubscribe := s.subscribeLive()
+	defer unsubscribe()
+	var send func(seg LiveSegment) error
+	var closed <-chan struct{}
+	if websocket.IsWebSocketUpgrade(req) {
+		ws, err := wsUpgrader.Upgrade(w, req, nil)
+		if err != nil {
+			s.Errorln("live upgrade:", err)
+			return
+		}
+		defer ws.Close()
+		// Clear the deadlines of the monitor server, the stream is long lived.
+		ws.SetReadDeadline(time.Time{})
+		send = func(seg LiveSegment) error {
+			ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			return ws.WriteJSON(seg)
+		}
+		// Read until the client closes the connection.
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				if _, _, err := ws.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+		closed = done
+	} else {
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		rc.Flush()
+		send = func(seg LiveSegment) error {
+			rc.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			b, err := json.Marshal(seg)
+			if err != nil {
+				return err
+			}
+			if _, err = fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+		closed = req.Context().Done()
+	}
+
+	tick := time.NewTicker(segmentDur)
+	defer tick.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-s.ctx.Done():
+			return
+		case now := <-tick.C:
+			seg := l.rollover(now)
+			s.mu.Lock()
+			seg.Status = strings.TrimSpace(s.status.LastStatus)
+			seg.DataReady = s.status.DataReady
+			s.mu.Unlock()
+			if err := send(seg); err != nil || seg.DataReady {
+				return
+			}
+		}
+	}
+}
+
+// wsUpgrader performs websocket upgrades of live streams.
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
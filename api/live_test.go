@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"stress/pkg/bench"
+
+	"github.com/minio/websocket"
+)
+
+func TestServerLive(t *testing.T) {
+	s := &Server{metrics: newMetrics()}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+	srv := httptest.NewServer(http.HandlerFunc(s.handleLive))
+	defer srv.Close()
+
+	// Operations completed while the streams are open are sent in the next segment.
+	observe := func() {
+		for i := 0; i < 100; i++ {
+			now := time.Now()
+			op := bench.Operation{OpType: "PUT", ObjPerOp: 1, Size: 1000, Start: now.Add(-time.Duration(i+1) * time.Millisecond), End: now}
+			if i == 0 {
+				op.Err = "failed"
+			}
+			s.Observe(op)
+		}
+	}
+	check := func(seg LiveSegment) bool {
+		if len(seg.Operations) == 0 {
+			return false
+		}
+		op := seg.Operations[0]
+		if op.Type != "PUT" || op.Ops != 100 || op.Errors != 1 || op.Bytes != 100000 || op.P50Millis < 40 || op.MaxMillis < 99 {
+			t.Errorf("unexpected segment %+v", op)
+		}
+		return true
+	}
+
+	resp, err := http.Get(srv.URL + "?segment=100ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("want event stream, got %q", ct)
+	}
+	observe()
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var seg LiveSegment
+		if err := json.Unmarshal([]byte(line), &seg); err != nil {
+			t.Fatal(err)
+		}
+		if check(seg) {
+			break
+		}
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?segment=100ms", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	// Wait until the stream is subscribed.
+	var seg LiveSegment
+	if err := ws.ReadJSON(&seg); err != nil {
+		t.Fatal(err)
+	}
+	observe()
+	for !check(seg) {
+		if err := ws.ReadJSON(&seg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The stream ends once the results are ready.
+	s.OperationsReady(bench.Operations{}, "test", "")
+	for !seg.DataReady {
+		if err := ws.ReadJSON(&seg); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
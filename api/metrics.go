@@ -0,0 +1,217 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"stress/config"
+	"stress/pkg/bench"
+)
+
+// metricsPrefix is the prefix of all exported metric names.
+const metricsPrefix = config.AppName + "_"
+
+// latencyBounds are the upper bounds in seconds of the operation duration histogram buckets.
+var latencyBounds = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+type opKey struct {
+	op, endpoint string
+}
+
+type errKey struct {
+	opKey
+	class string
+}
+
+// opMetrics contains the metrics of an operation type to an endpoint.
+type opMetrics struct {
+	ops, bytes, objects, requests int64
+	// buckets counts operations by latencyBounds, the last one counts longer operations.
+	buckets []int64
+	seconds float64
+}
+
+// metrics contains live metrics of the operations completed so far.
+type metrics struct {
+	mu        sync.Mutex
+	started   time.Time
+	ops       map[opKey]*opMetrics
+	failed    map[errKey]int64
+	transient map[errKey]int64
+	inFlight  *bench.InFlight
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		started:   time.Now(),
+		ops:       make(map[opKey]*opMetrics),
+		failed:    make(map[errKey]int64),
+		transient: make(map[errKey]int64),
+	}
+}
+
+func (m *metrics) observe(op bench.Operation) {
+	k := opKey{op: op.OpType, endpoint: op.Endpoint}
+	d := op.Duration().Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	om := m.ops[k]
+	if om == nil {
+		om = &opMetrics{buckets: make([]int64, len(latencyBounds)+1)}
+		m.ops[k] = om
+	}
+	om.ops++
+	om.bytes += op.Size
+	om.objects += int64(op.ObjPerOp)
+	if op.Attempts > 1 {
+		om.requests += int64(op.Attempts)
+	} else {
+		om.requests++
+	}
+	om.buckets[sort.SearchFloat64s(latencyBounds, d)]++
+	om.seconds += d
+	switch {
+	case op.Err != "":
+		class := op.ErrClass
+		if class == "" {
+			class = bench.ErrClassOther
+		}
+		m.failed[errKey{opKey: k, class: class}]++
+	case op.ErrClass != "":
+		m.transient[errKey{opKey: k, class: op.ErrClass}]++
+	}
+}
+
+// write writes the metrics in the Prometheus text exposition format.
+func (m *metrics) write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	m.mu.Lock()
+	keys := make([]opKey, 0, len(m.ops))
+	for k := range m.ops {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].op != keys[j].op {
+			return keys[i].op < keys[j].op
+		}
+		return keys[i].endpoint < keys[j].endpoint
+	})
+	counter := func(name, help string, get func(om *opMetrics) int64) {
+		writeMetricHeader(bw, name, "counter", help)
+		for _, k := range keys {
+			fmt.Fprintf(bw, "%s%s{%s} %d\n", metricsPrefix, name, k.labels(), get(m.ops[k]))
+		}
+	}
+	counter("ops_total", "Completed operations.", func(om *opMetrics) int64 { return om.ops })
+	counter("objects_total", "Objects of completed operations.", func(om *opMetrics) int64 { return om.objects })
+	counter("bytes_total", "Bytes transferred by completed operations.", func(om *opMetrics) int64 { return om.bytes })
+	counter("requests_total", "Requests made by completed operations, including retries.", func(om *opMetrics) int64 { return om.requests })
+
+	writeMetricHeader(bw, "op_duration_seconds", "histogram", "Duration of completed operations, including retries.")
+	for _, k := range keys {
+		om := m.ops[k]
+		var n int64
+		for i, c := range om.buckets {
+			n += c
+			le := "+Inf"
+			if i < len(latencyBounds) {
+				le = strconv.FormatFloat(latencyBounds[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(bw, "%sop_duration_seconds_bucket{%s,le=%q} %d\n", metricsPrefix, k.labels(), le, n)
+		}
+		fmt.Fprintf(bw, "%sop_duration_seconds_sum{%s} %g\n", metricsPrefix, k.labels(), om.seconds)
+		fmt.Fprintf(bw, "%sop_duration_seconds_count{%s} %d\n", metricsPrefix, k.labels(), om.ops)
+	}
+
+	writeErrors(bw, "errors_total", "Failed operations by error class.", m.failed)
+	writeErrors(bw, "transient_errors_total", "Operations that succeeded when retried, by class of the last error.", m.transient)
+	started := m.started
+	inFlight := m.inFlight
+	m.mu.Unlock()
+
+	if inFlight != nil {
+		writeMetricHeader(bw, "requests_in_flight", "gauge", "Requests in progress.")
+		for _, c := range inFlight.Counts() {
+			fmt.Fprintf(bw, "%srequests_in_flight{method=%s,endpoint=%s} %d\n", metricsPrefix, labelValue(c.Method), labelValue(c.Endpoint), c.N)
+		}
+	}
+	writeMetricHeader(bw, "start_time_seconds", "gauge", "Start time of the monitor since unix epoch in seconds.")
+	fmt.Fprintf(bw, "%sstart_time_seconds %d\n", metricsPrefix, started.Unix())
+	return bw.Flush()
+}
+
+// writeErrors writes error counters sorted by labels.
+func writeErrors(w io.Writer, name, help string, errs map[errKey]int64) {
+	keys := make([]errKey, 0, len(errs))
+	for k := range errs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.op != b.op {
+			return a.op < b.op
+		}
+		if a.endpoint != b.endpoint {
+			return a.endpoint < b.endpoint
+		}
+		return a.class < b.class
+	})
+	writeMetricHeader(w, name, "counter", help)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s{%s,class=%s} %d\n", metricsPrefix, name, k.labels(), labelValue(k.class), errs[k])
+	}
+}
+
+func writeMetricHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricsPrefix, name, help, metricsPrefix, name, typ)
+}
+
+func (k opKey) labels() string {
+	return "op=" + labelValue(k.op) + ",endpoint=" + labelValue(k.endpoint)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue returns a quoted and escaped label value.
+func labelValue(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
+
+// Observe updates the live metrics and streams with a completed operation.
+// It implements bench.OpObserver, so the server can be added to collectors.
+func (s *Server) Observe(op bench.Operation) {
+	if s.metrics == nil {
+		return
+	}
+	s.metrics.observe(op)
+	s.observeLive(op)
+}
+
+// SetInFlight sets the counter of requests in progress exported as metric.
+func (s *Server) SetInFlight(f *bench.InFlight) {
+	if s.metrics == nil {
+		return
+	}
+	s.metrics.mu.Lock()
+	s.metrics.inFlight = f
+	s.metrics.mu.Unlock()
+}
+
+// handleMetrics handles GET `/metrics` requests in Prometheus text exposition format.
+func (s *Server) handleMetrics(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := s.metrics.write(w); err != nil {
+		s.Errorln(err)
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"stress/pkg/bench"
+)
+
+func TestServerMetrics(t *testing.T) {
+	s := &Server{metrics: newMetrics()}
+	var inFlight bench.InFlight
+	s.SetInFlight(&inFlight)
+	done := inFlight.Start("PUT", "http://127.0.0.1:9000")
+	inFlight.Start("GET", "http://127.0.0.1:9000")
+	done()
+
+	col := bench.NewCollector()
+	col.AddObserver(s)
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	rcv := col.Receiver()
+	for i, d := range []time.Duration{20 * time.Millisecond, 200 * time.Millisecond, 3 * time.Second} {
+		op := bench.Operation{OpType: "PUT", ObjPerOp: 1, Size: 100, Endpoint: "http://127.0.0.1:9000", Start: start, End: start.Add(d)}
+		switch i {
+		case 1:
+			op.Attempts, op.ErrClass = 2, "SlowDown"
+		case 2:
+			op.Err, op.ErrClass = "timeout", bench.ErrClassTimeout
+		}
+		rcv <- op
+	}
+	col.Close()
+
+	rec := httptest.NewRecorder()
+	s.handleMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+	b, _ := io.ReadAll(rec.Body)
+	got := string(b)
+	for _, want := range []string{
+		`stress_ops_total{op="PUT",endpoint="http://127.0.0.1:9000"} 3`,
+		`stress_bytes_total{op="PUT",endpoint="http://127.0.0.1:9000"} 300`,
+		`stress_requests_total{op="PUT",endpoint="http://127.0.0.1:9000"} 4`,
+		`stress_op_duration_seconds_bucket{op="PUT",endpoint="http://127.0.0.1:9000",le="0.025"} 1`,
+		`stress_op_duration_seconds_bucket{op="PUT",endpoint="http://127.0.0.1:9000",le="0.25"} 2`,
+		`stress_op_duration_seconds_bucket{op="PUT",endpoint="http://127.0.0.1:9000",le="+Inf"} 3`,
+		`stress_op_duration_seconds_count{op="PUT",endpoint="http://127.0.0.1:9000"} 3`,
+		`stress_errors_total{op="PUT",endpoint="http://127.0.0.1:9000",class="timeout"} 1`,
+		`stress_transient_errors_total{op="PUT",endpoint="http://127.0.0.1:9000",class="SlowDown"} 1`,
+		`stress_requests_in_flight{method="GET",endpoint="http://127.0.0.1:9000"} 1`,
+		`stress_requests_in_flight{method="PUT",endpoint="http://127.0.0.1:9000"} 0`,
+		"# TYPE stress_op_duration_seconds histogram",
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
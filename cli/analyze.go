@@ -33,6 +33,7 @@ import (
 	"stress/pkg/bench"
 	"stress/pkg/printer"
 	"stress/pkg/utils"
+	"stress/workflow"
 
 	"github.com/fatih/color"
 	"github.com/klauspost/compress/zstd"
@@ -95,15 +96,17 @@ var analyzeCmd = cli.Command{
 	Usage:  "analyze existing benchmark data",
 	Action: mainAnalyze,
 	Before: setGlobalsFromContext,
-	Flags:  combineFlags(globalFlags, analyzeFlags),
+	Flags:  combineFlags(globalFlags, analyzeFlags, driftFlags),
 	CustomHelpTemplate: `NAME:
   {{.HelpName}} - {{.Usage}}
 
 USAGE:
-  {{.HelpName}} [FLAGS] benchmark-data-file
+  {{.HelpName}} [FLAGS] benchmark-data-file...
   -> see https://github.com/minio/warp#analysis
 
 Use - as input to read from stdin.
+Multiple files are analyzed as a single run. Give the file name prefix
+of a run written with --spill to analyze all of its chunk files.
 
 FLAGS:
   {{range .VisibleFlags}}{{.}}
@@ -117,9 +120,6 @@ func mainAnalyze(ctx *cli.Context) error {
 	if len(args) == 0 {
 		console.Fatal("No benchmark data file supplied")
 	}
-	if len(args) > 1 {
-		console.Fatal("Only one benchmark file can be given")
-	}
 	zstdDec, _ := zstd.NewReader(nil)
 	defer zstdDec.Close()
 	monitor := api.NewBenchmarkMonitor(ctx.String(serverFlagName))
@@ -128,27 +128,94 @@ func mainAnalyze(ctx *cli.Context) error {
 	if config.GlobalQuiet {
 		log = nil
 	}
-	for _, arg := range args {
-		var input io.Reader
-		if arg == "-" {
-			input = os.Stdin
-		} else {
-			f, err := os.Open(arg)
-			printer.FatalIf(probe.NewError(err), "Unable to open input file")
-			defer f.Close()
-			input = f
+	// All files are read as a single run, in the order given.
+	files := analyzeInputs(args)
+	var readers []io.Reader
+	for _, file := range files {
+		if file == "-" {
+			readers = append(readers, os.Stdin)
+			continue
 		}
-		err := zstdDec.Reset(input)
-		printer.FatalIf(probe.NewError(err), "Unable to read input")
-		ops, err := bench.OperationsFromCSV(zstdDec, true, ctx.Int("analyze.offset"), ctx.Int("analyze.limit"), log)
-		printer.FatalIf(probe.NewError(err), "Unable to parse input")
+		f, err := os.Open(file)
+		printer.FatalIf(probe.NewError(err), "Unable to open input file")
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	// Concatenated zstd streams decode as one.
+	err := zstdDec.Reset(io.MultiReader(readers...))
+	printer.FatalIf(probe.NewError(err), "Unable to read input")
+	ops, err := bench.OperationsFromCSV(zstdDec, true, ctx.Int("analyze.offset"), ctx.Int("analyze.limit"), log)
+	printer.FatalIf(probe.NewError(err), "Unable to parse input")
+	if len(files) > 1 {
+		ops.SortByStartTime()
+	}
 
-		printAnalysis(ctx, ops)
-		monitor.OperationsReady(ops, strings.TrimSuffix(filepath.Base(arg), ".csv.zst"), utils.CommandLine(ctx))
+	printAnalysis(ctx, ops)
+	if !config.GlobalJSON {
+		for _, lag := range ops.LagSummaryByOp() {
+			console.Println("\n" + lag.String(10))
+		}
+		for _, r := range ops.RetrySummaryByOp() {
+			console.Println("\n" + r.String())
+		}
+	}
+	pass := printDrift(ctx, ops)
+	monitor.OperationsReady(ops, strings.TrimSuffix(filepath.Base(args[0]), ".csv.zst"), utils.CommandLine(ctx))
+	if !pass {
+		return errors.New("performance degraded during the run")
 	}
 	return nil
 }
 
+// printDrift prints the degradation analysis of the run, if enabled, and returns whether it passed.
+func printDrift(ctx *cli.Context, o bench.Operations) bool {
+	opts := workflow.DriftOptions(ctx)
+	if opts.Window <= 0 {
+		return true
+	}
+	if onlyHost := ctx.String("analyze.host"); onlyHost != "" {
+		o = o.FilterByEndpoint(onlyHost)
+	}
+	if wantOp := ctx.String("analyze.op"); wantOp != "" {
+		o = o.FilterByOp(wantOp)
+	}
+	opts.SkipDur = ctx.Duration("analyze.skip")
+	rep := aggregate.Drift(o, opts)
+	if config.GlobalJSON {
+		b, err := json.MarshalIndent(rep, "", "  ")
+		printer.FatalIf(probe.NewError(err), "Unable to marshal data.")
+		os.Stdout.Write(b)
+		return rep.Pass
+	}
+	console.Println("\n" + rep.String())
+	return rep.Pass
+}
+
+// analyzeInputs returns the files to analyze.
+// An argument that is not an existing file is taken as the prefix of a set of chunk files.
+func analyzeInputs(args []string) []string {
+	var files []string
+	for _, arg := range args {
+		if arg == "-" {
+			if len(args) > 1 {
+				console.Fatal("stdin cannot be combined with other benchmark files")
+			}
+			return args
+		}
+		if _, err := os.Stat(arg); err == nil {
+			files = append(files, arg)
+			continue
+		}
+		chunks, err := bench.ChunkFiles(strings.TrimSuffix(arg, ".csv.zst"))
+		printer.FatalIf(probe.NewError(err), "Unable to list chunk files")
+		if len(chunks) == 0 {
+			console.Fatalf("Unable to open input file %q: no such file or chunk files\n", arg)
+		}
+		files = append(files, chunks...)
+	}
+	return files
+}
+
 func printMixedOpAnalysis(ctx *cli.Context, aggr aggregate.Aggregated, details bool) {
 	console.SetColor("Print", color.New(color.FgWhite))
 	console.Printf("Mixed operations.")
@@ -258,7 +325,7 @@ func printAnalysis(ctx *cli.Context, o bench.Operations) {
 			hosts := o.Endpoints()
 			console.Println("Host not found, valid hosts are:")
 			for _, h := range hosts {
-				console.Println("\t* %s", h)
+				console.Printf("\t* %s\n", h)
 			}
 			return
 		}
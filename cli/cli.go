@@ -60,6 +60,7 @@ func Main(args []string) {
 func init() {
 	a := []cli.Command{
 		videoS3Cmd,
+		videoPlanCmd,
 		// mixedCmd,
 		// getCmd,
 		// putCmd,
@@ -74,7 +75,7 @@ func init() {
 		// snowballCmd,
 	}
 	b := []cli.Command{
-		// analyzeCmd,
+		analyzeCmd,
 		// cmpCmd,
 		// mergeCmd,
 		// clientCmd,
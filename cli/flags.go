@@ -3,6 +3,9 @@ package cli
 import (
 	"fmt"
 	"stress/config"
+	"stress/pkg/bench"
+	"strings"
+	"time"
 
 	s3client "stress/client/s3"
 
@@ -107,6 +110,139 @@ func setGlobals(quiet, debug, json, noColor bool) {
 	}
 }
 
+// Flags for writing operations to chunk files while running, instead of keeping them in memory.
+var spillFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "spill",
+		Usage: "spillFlags: Write operations to rotating chunk files while running and keep only running totals in memory. Analyze the chunk set by its prefix.",
+	},
+	cli.IntFlag{
+		Name:  "spill.ops",
+		Value: 1000000,
+		Usage: "spillFlags: Maximum number of operations in a chunk file.",
+	},
+	cli.DurationFlag{
+		Name:  "spill.dur",
+		Value: time.Hour,
+		Usage: "spillFlags: Start a new chunk file after this duration, 0 to rotate by number of operations only.",
+	},
+	cli.IntFlag{
+		Name:   "spill.keep",
+		Value:  10000,
+		Usage:  "spillFlags: Number of most recent operations kept in memory.",
+		Hidden: true,
+	},
+}
+
+// Flags for detecting degradation of a long run compared to a baseline at its start.
+var driftFlags = []cli.Flag{
+	cli.DurationFlag{
+		Name:  "drift",
+		Usage: "driftFlags: Compare windows of this length to a baseline at the start of the run and fail on significant degradation. While running it is also the report period. 0 disables.",
+	},
+	cli.IntFlag{
+		Name:  "drift.baseline",
+		Value: 3,
+		Usage: "driftFlags: Number of windows at the start of the run used as baseline.",
+	},
+	cli.Float64Flag{
+		Name:  "drift.throughput",
+		Value: 10,
+		Usage: "driftFlags: Tolerated throughput drop in percent.",
+	},
+	cli.Float64Flag{
+		Name:  "drift.latency",
+		Value: 25,
+		Usage: "driftFlags: Tolerated p50 and p99 latency rise in percent.",
+	},
+	cli.Float64Flag{
+		Name:  "drift.errors",
+		Value: 1,
+		Usage: "driftFlags: Tolerated error rate rise in percentage points.",
+	},
+	cli.Float64Flag{
+		Name:  "drift.sigma",
+		Value: 3,
+		Usage: "driftFlags: Number of standard deviations a change must exceed to be significant.",
+	},
+}
+
+// Flags for monitoring a running workflow.
+var serveFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  serverFlagName,
+		Usage: "serveFlags: Open a webserver with the status, the results, live Prometheus metrics at /metrics and live aggregates at /v1/live while running, eg: localhost:7762",
+	},
+}
+
+// Flags for retrying failed requests.
+var retryFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:  "retry.max",
+		Value: 1,
+		Usage: "retryFlags: Maximum number of attempts of a request, 1 disables retrying. When retrying, the built-in retries of the S3 client are disabled so every attempt is recorded.",
+	},
+	cli.DurationFlag{
+		Name:  "retry.backoff",
+		Value: 100 * time.Millisecond,
+		Usage: "retryFlags: Delay before the first retry. It doubles for each following retry, with random jitter.",
+	},
+	cli.DurationFlag{
+		Name:  "retry.backoff.max",
+		Value: 10 * time.Second,
+		Usage: "retryFlags: Maximum delay between retries.",
+	},
+	cli.StringFlag{
+		Name:  "retry.on",
+		Value: strings.Join(bench.DefaultRetryOn, ","),
+		Usage: "retryFlags: Comma separated S3 error codes, HTTP status codes and network error classes (timeout, conn-reset, conn-refused, dns, eof, network) to retry.",
+	},
+	cli.StringFlag{
+		Name:  "retry.op",
+		Usage: "retryFlags: Semicolon separated retry policies per operation type, e.g. 'PUT:max=5,backoff=200ms,max-backoff=5s,on=SlowDown|503;DELETE:max=2'.",
+	},
+}
+
+// retryPolicies returns the retry policies of the retry flags.
+// The default policy has the empty operation type.
+func retryPolicies(ctx *cli.Context) map[string]bench.RetryPolicy {
+	def := bench.RetryPolicy{
+		MaxAttempts: ctx.Int("retry.max"),
+		Backoff:     ctx.Duration("retry.backoff"),
+		MaxBackoff:  ctx.Duration("retry.backoff.max"),
+	}
+	for _, on := range strings.Split(ctx.String("retry.on"), ",") {
+		if on = strings.TrimSpace(on); on != "" {
+			def.RetryOn = append(def.RetryOn, on)
+		}
+	}
+	var specs []string
+	for _, spec := range strings.Split(ctx.String("retry.op"), ";") {
+		if strings.TrimSpace(spec) != "" {
+			specs = append(specs, spec)
+		}
+	}
+	res, err := bench.ParseRetryPolicies(def, specs)
+	if err != nil {
+		console.Fatal(err)
+	}
+	res[""] = def
+	return res
+}
+
+// Flags for stopping a run on SIGINT or SIGTERM.
+var shutdownFlags = []cli.Flag{
+	cli.DurationFlag{
+		Name:  "shutdown.timeout",
+		Value: 30 * time.Second,
+		Usage: "shutdownFlags: On interrupt, wait this long for operations in progress before saving results, 0 to wait until they finish.",
+	},
+	cli.BoolFlag{
+		Name:  "shutdown.cleanup",
+		Usage: "shutdownFlags: Clean up the benchmark data after an interrupt. By default data and state are kept so the run can be resumed.",
+	},
+}
+
 // Flags common across all I/O commands such as cp, mirror, stat, pipe etc.
 var aliasFlags = []cli.Flag{
 	cli.StringFlag{
@@ -65,6 +65,11 @@ func newGenSourceCSV(ctx *cli.Context) func() generator.Source {
 
 // newGenSource returns a new generator
 func newGenSource(ctx *cli.Context, sizeField string) func() generator.Source {
+	return newGenSourceSize(ctx, ctx.String(sizeField))
+}
+
+// newGenSourceSize returns a new generator with the size given as "size" or "min,max".
+func newGenSourceSize(ctx *cli.Context, sizeSpec string) func() generator.Source {
 	prefixSize := 8
 	if ctx.Bool("noprefix") {
 		prefixSize = 0
@@ -85,7 +90,7 @@ func newGenSource(ctx *cli.Context, sizeField string) func() generator.Source {
 		generator.WithCustomPrefix(ctx.String("prefix")),
 		generator.WithPrefixSize(prefixSize),
 	}
-	tokens := strings.Split(ctx.String(sizeField), ",")
+	tokens := strings.Split(sizeSpec, ",")
 	switch len(tokens) {
 	case 1:
 		size, err := toSize(tokens[0])
@@ -104,7 +109,7 @@ func newGenSource(ctx *cli.Context, sizeField string) func() generator.Source {
 		}
 		opts = append(opts, generator.WithMinMaxSize(int64(minSize), int64(maxSize)))
 	default:
-		printer.FatalIf(probe.NewError(fmt.Errorf("unexpected obj.size specified: %s", ctx.String(sizeField))), "Invalid obj.size parameter")
+		printer.FatalIf(probe.NewError(fmt.Errorf("unexpected obj.size specified: %s", sizeSpec)), "Invalid obj.size parameter")
 	}
 	opts = append([]generator.Option{g.Apply()}, append(opts, generator.WithRandomSize(ctx.Bool("obj.randsize")))...)
 	src, err := generator.NewFn(opts...)
@@ -112,6 +117,13 @@ func newGenSource(ctx *cli.Context, sizeField string) func() generator.Source {
 	return src
 }
 
+// newFileSource returns a generator uploading the content of the files in rotating order.
+func newFileSource(paths []string) func() generator.Source {
+	src, err := generator.NewFn(generator.WithFiles(paths...).Apply())
+	printer.FatalIf(probe.NewError(err), "Unable to create file data source")
+	return src
+}
+
 // toSize converts a size indication to bytes.
 func toSize(size string) (uint64, error) {
 	return humanize.ParseBytes(size)
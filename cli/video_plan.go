@@ -0,0 +1,290 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	. "stress/pkg/logger"
+	"stress/workflow/video"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/cli"
+	"github.com/minio/pkg/console"
+	"go.uber.org/zap"
+)
+
+// maxSweepValues 单个参数扫描的最大取值个数
+const maxSweepValues = 10000
+
+var videoPlanFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "sweep.channel-num",
+		Value: "",
+		Usage: "规划 - 视频路数取值, 逗号分隔或 起始-结束:步长, 如 100,200 或 100-1000:100; 为空时使用 channel-num.",
+	},
+	cli.StringFlag{
+		Name:  "sweep.bitstream",
+		Value: "",
+		Usage: "规划 - 视频码流(Mbps)取值, 如 2,4,8 或 2-8:2; 为空时使用 bitstream.",
+	},
+	cli.StringFlag{
+		Name:  "sweep.capacity",
+		Value: "",
+		Usage: "规划 - 集群可用空间取值, 如 100TiB,200TiB 或 100TiB-500TiB:100TiB; 为空时使用 capacity.",
+	},
+	cli.StringFlag{
+		Name:  "sweep.datalife",
+		Value: "",
+		Usage: "规划 - 保留期限(天)取值, 如 7,15,30 或 7-35:7; 为空时使用 datalife.",
+	},
+	cli.StringFlag{
+		Name:  "format",
+		Value: "table",
+		Usage: "规划 - 输出格式: table, json, csv.",
+	},
+}
+
+// Video plan command.
+var videoPlanCmd = cli.Command{
+	Name:   "video-plan",
+	Usage:  "video scene capacity planning, no storage access",
+	Action: mainVideoPlan,
+	Before: setGlobalsFromContext,
+	Flags:  combineFlags(videoBaseFlags, videoPlanFlags, globalFlags),
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} [FLAGS]
+  -> see https://github.com/txu2k8/storage-stress-test#video-plan
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}`,
+}
+
+// videoPlanRow 一组参数组合的数据模型
+type videoPlanRow struct {
+	ChannelNum        int     `json:"channel_num"`
+	BitStream         float32 `json:"bitstream_mbps"`
+	Capacity          uint64  `json:"capacity_bytes"`
+	SafeWaterLevel    float32 `json:"safe_water_level"`
+	ObjSize           uint64  `json:"obj_size_bytes"`
+	DataLife          float32 `json:"datalife_days"`
+	ObjNum            int     `json:"obj_num"`
+	ObjNumPC          int     `json:"obj_num_per_channel"`
+	ObjNumPCPD        int     `json:"obj_num_per_channel_per_day"`
+	BucketNum         int     `json:"bucket_num"`
+	BandWidth         float32 `json:"bandwidth_mib_s"`
+	PeakBandWidth     float32 `json:"peak_bandwidth_mib_s"`
+	TimeInterval      float32 `json:"time_interval_s"`
+	MainConcurrent    float32 `json:"main_concurrent"`
+	PrepareConcurrent float32 `json:"prepare_concurrent"`
+	Error             string  `json:"error,omitempty"`
+}
+
+// mainVideoPlan 视频监控场景容量规划：只计算数据模型，不访问存储
+func mainVideoPlan(ctx *cli.Context) error {
+	if ctx.NArg() > 0 {
+		console.Fatal("Command takes no arguments")
+	}
+	if ctx.Bool("debug") {
+		InitLogger("video_plan", "text", "debug", ctx.Bool("verbose"))
+	} else {
+		Logger = zap.NewNop().Sugar()
+	}
+	format := ctx.String("format")
+	if ctx.Bool("json") {
+		format = "json"
+	}
+	switch format {
+	case "table", "json", "csv":
+	default:
+		console.Fatalf("unknown format: %s\n", format)
+	}
+
+	channels := sweepValues(ctx, "sweep.channel-num", strconv.Itoa(ctx.Int("channel-num")), parseFloat)
+	bitstreams := sweepValues(ctx, "sweep.bitstream", fmt.Sprint(ctx.Float64("bitstream")), parseFloat)
+	capacities := sweepValues(ctx, "sweep.capacity", ctx.String("capacity"), parseSize)
+	datalifes := sweepValues(ctx, "sweep.datalife", fmt.Sprint(ctx.Float64("datalife")), parseFloat)
+	if ctx.String("scenario") != "" && (len(channels) > 1 || len(bitstreams) > 1 || len(datalifes) > 1) {
+		console.Fatal("sweep.channel-num, sweep.bitstream and sweep.datalife cannot be used with --scenario, only sweep.capacity")
+	}
+
+	// 源文件由 CalcData 读取，与 video-s3 一致：目录按其中文件的平均大小计算
+	base := newVideoInfo(ctx)
+
+	var rows []videoPlanRow
+	for _, capacity := range capacities {
+		for _, bitstream := range bitstreams {
+			for _, channel := range channels {
+				for _, datalife := range datalifes {
+					v := base
+					v.Groups = append([]video.VideoInfo(nil), base.Groups...)
+					v.TotalCapacity = uint64(capacity)
+					if len(v.Groups) == 0 {
+						v.ChannelNum = int(channel)
+						v.BitStream = float32(bitstream)
+						v.DataLife = float32(datalife)
+					}
+					rows = append(rows, planRow(v))
+				}
+			}
+		}
+	}
+	if len(rows) == 1 && rows[0].Error != "" {
+		console.Fatalln("Invalid video parameters:", rows[0].Error)
+	}
+
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case "csv":
+		return writePlanCSV(rows)
+	default:
+		writePlanTable(rows)
+	}
+	return nil
+}
+
+// planRow 计算一组参数的数据模型
+func planRow(v video.VideoInfo) videoPlanRow {
+	row := videoPlanRow{
+		ChannelNum:     v.ChannelNum,
+		BitStream:      v.BitStream,
+		Capacity:       v.TotalCapacity,
+		SafeWaterLevel: v.SafeWaterLevel,
+		ObjSize:        v.FileInfo.Size,
+		DataLife:       v.DataLife,
+	}
+	if err := v.CalcData(); err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	row.ChannelNum = v.ChannelNum
+	row.BitStream = v.BitStream
+	row.ObjSize = v.FileInfo.Size
+	row.DataLife = v.DataLife
+	row.ObjNum = v.ObjNum
+	row.ObjNumPC = v.ObjNumPC
+	row.ObjNumPCPD = v.ObjNumPCPD
+	row.BucketNum = v.BucketNum
+	row.BandWidth = v.BandWidth
+	row.PeakBandWidth = v.PeakBandWidth
+	row.TimeInterval = v.TimeInterval
+	row.MainConcurrent = v.MainConcurrent
+	row.PrepareConcurrent = v.PrepareConcurrent
+	return row
+}
+
+func writePlanTable(rows []videoPlanRow) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "路数\t码流(Mbps)\t容量\t对象大小\t保留期限(天)\t对象总数\t每路对象数\t每路每天对象数\t桶数\t带宽(MiB/s)\t峰值带宽(MiB/s)\t对象间隔(s)\t写删每秒对象数\t预埋每秒对象数\t错误")
+	for _, r := range rows {
+		if r.Error != "" {
+			fmt.Fprintf(w, "%d\t%v\t%s\t%s\t%.3f\t-\t-\t-\t-\t-\t-\t-\t-\t-\t%s\n",
+				r.ChannelNum, r.BitStream, humanize.IBytes(r.Capacity), humanize.IBytes(r.ObjSize), r.DataLife, r.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%d\t%v\t%s\t%s\t%.3f\t%d\t%d\t%d\t%d\t%.2f\t%.2f\t%.2f\t%.3f\t%.3f\t\n",
+			r.ChannelNum, r.BitStream, humanize.IBytes(r.Capacity), humanize.IBytes(r.ObjSize), r.DataLife,
+			r.ObjNum, r.ObjNumPC, r.ObjNumPCPD, r.BucketNum, r.BandWidth, r.PeakBandWidth, r.TimeInterval, r.MainConcurrent, r.PrepareConcurrent)
+	}
+	w.Flush()
+}
+
+func writePlanCSV(rows []videoPlanRow) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"channel_num", "bitstream_mbps", "capacity_bytes", "safe_water_level", "obj_size_bytes", "datalife_days",
+		"obj_num", "obj_num_per_channel", "obj_num_per_channel_per_day", "bucket_num", "bandwidth_mib_s", "peak_bandwidth_mib_s", "time_interval_s",
+		"main_concurrent", "prepare_concurrent", "error"})
+	for _, r := range rows {
+		w.Write([]string{
+			strconv.Itoa(r.ChannelNum), fmt.Sprint(r.BitStream), strconv.FormatUint(r.Capacity, 10), fmt.Sprint(r.SafeWaterLevel),
+			strconv.FormatUint(r.ObjSize, 10), fmt.Sprint(r.DataLife), strconv.Itoa(r.ObjNum), strconv.Itoa(r.ObjNumPC),
+			strconv.Itoa(r.ObjNumPCPD), strconv.Itoa(r.BucketNum), fmt.Sprint(r.BandWidth), fmt.Sprint(r.PeakBandWidth), fmt.Sprint(r.TimeInterval),
+			fmt.Sprint(r.MainConcurrent), fmt.Sprint(r.PrepareConcurrent), r.Error,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// sweepValues 解析参数扫描取值，未指定时使用 def
+func sweepValues(ctx *cli.Context, name, def string, parse func(string) (float64, error)) []float64 {
+	spec := ctx.String(name)
+	if spec == "" {
+		spec = def
+	}
+	values, err := parseSweep(spec, parse)
+	if err != nil {
+		console.Fatalf("Invalid %s: %v\n", name, err)
+	}
+	return values
+}
+
+// parseSweep 解析取值列表：逗号分隔的值或 起始-结束:步长 范围
+func parseSweep(spec string, parse func(string) (float64, error)) ([]float64, error) {
+	var values []float64
+	for _, token := range strings.Split(spec, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		rng, stepStr, isRange := strings.Cut(token, ":")
+		if !isRange {
+			v, err := parse(token)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+			continue
+		}
+		fromStr, toStr, ok := strings.Cut(rng, "-")
+		if !ok {
+			return nil, fmt.Errorf("range %q: want start-end:step", token)
+		}
+		from, err := parse(fromStr)
+		if err != nil {
+			return nil, err
+		}
+		to, err := parse(toStr)
+		if err != nil {
+			return nil, err
+		}
+		step, err := parse(stepStr)
+		if err != nil {
+			return nil, err
+		}
+		if step <= 0 || from > to {
+			return nil, fmt.Errorf("range %q: want start <= end and step > 0", token)
+		}
+		for n := 0; from+float64(n)*step <= to; n++ {
+			values = append(values, from+float64(n)*step)
+			if len(values) > maxSweepValues {
+				return nil, fmt.Errorf("range %q: more than %d values", token, maxSweepValues)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no values in %q", spec)
+	}
+	return values, nil
+}
+
+func parseFloat(s string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSpace(s), 64)
+}
+
+func parseSize(s string) (float64, error) {
+	size, err := toSize(strings.TrimSpace(s))
+	return float64(size), err
+}
@@ -2,6 +2,8 @@ package cli
 
 import (
 	"os"
+	"strconv"
+	fileOps "stress/client/fs"
 	s3client "stress/client/s3"
 	"stress/models"
 	. "stress/pkg/logger"
@@ -9,6 +11,7 @@ import (
 	"stress/workflow/video"
 	s3worker "stress/workflow/video/s3"
 	"strings"
+	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/minio/cli"
@@ -47,6 +50,15 @@ var videoBaseFlags = []cli.Flag{
 		Value: "",
 		Usage: "业务模型 - 指定源文件路径（指定目录）.",
 	},
+	cli.StringFlag{
+		Name:  "scenario",
+		Value: "",
+		Usage: "业务模型 - 场景文件(YAML/JSON), 定义多组不同码流、对象大小、分片数、保留期限、桶前缀的视频.",
+	},
+	cli.BoolFlag{
+		Name:  "file-payload",
+		Usage: "业务模型 - 上传 local-path 源文件的真实内容(目录则轮流上传其中所有非空文件, 数据模型按文件平均大小计算), 默认上传随机数据.",
+	},
 	cli.BoolFlag{
 		Name:  "appendable",
 		Usage: "业务模型 - 是否追加写模式.",
@@ -56,6 +68,25 @@ var videoBaseFlags = []cli.Flag{
 		Value: 1,
 		Usage: "业务模型 - 追加写模式下，追加写入分片数(源文件分片后追加写入).",
 	},
+	cli.Float64Flag{
+		Name:  "event.rate",
+		Value: 0,
+		Usage: "业务模型 - 移动侦测事件频率(每路视频每小时平均事件数, 泊松到达), 0表示恒定码流.",
+	},
+	cli.Float64Flag{
+		Name:  "event.duration",
+		Value: 60,
+		Usage: "业务模型 - 事件平均持续时长(单位: 秒).",
+	},
+	cli.Float64Flag{
+		Name:  "event.multiplier",
+		Value: 2,
+		Usage: "业务模型 - 事件期间码流为 bitstream 的倍数.",
+	},
+	cli.BoolFlag{
+		Name:  "event.motion-only",
+		Usage: "业务模型 - 仅在事件期间录像, 非事件期间不产生数据, 事件结束时写入不足一个对象大小的数据.",
+	},
 	cli.BoolFlag{
 		Name:  "disable-multipart",
 		Usage: "业务模型 - 非多段上传, 与appendable互斥, 即非追加写模式生效.",
@@ -74,12 +105,12 @@ var videoBaseFlags = []cli.Flag{
 	cli.IntFlag{
 		Name:  "max-workers",
 		Value: 1,
-		Usage: "业务模型 - 每路视频最大并发数.",
+		Usage: "业务模型 - 每路视频最大并发数, 所有视频共享 concurrent 全局并发上限, 写入慢于码流时排队并告警积压.",
 	},
 	cli.IntFlag{
 		Name:  "prepare-channel-num",
-		Value: 1,
-		Usage: "业务模型 - 数据预埋节点模拟视频路数（增大以加快预埋速度）.",
+		Value: 0,
+		Usage: "业务模型 - 数据预埋阶段模拟视频路数（增大以加快预埋速度）, 0表示与视频路数相同.",
 	},
 	cli.StringFlag{
 		Name:  "obj.size",
@@ -113,6 +144,10 @@ var videoCustomFlags = []cli.Flag{
 		Name:  "skip-stage-init",
 		Usage: "自定义 - 跳过创建桶阶段.",
 	},
+	cli.BoolFlag{
+		Name:  "skip-stage-prefill",
+		Usage: "自定义 - 跳过数据预埋阶段.",
+	},
 	cli.BoolFlag{
 		Name:  "write-only",
 		Usage: "自定义 - 只写入，不删除.",
@@ -130,15 +165,118 @@ var videoCustomFlags = []cli.Flag{
 		Value: "video",
 		Usage: "自定义 - 单根目录时，根目录名称.",
 	},
+	cli.BoolFlag{
+		Name:  "bucket-lock",
+		Usage: "自定义 - 创建桶时开启对象锁定(WORM).",
+	},
+	cli.BoolFlag{
+		Name:  "resume",
+		Usage: "自定义 - 从状态文件断点续跑.",
+	},
+	cli.StringFlag{
+		Name:  "state-file",
+		Value: "video_s3.state.json",
+		Usage: "自定义 - 状态文件路径, 记录每路视频写入/删除进度, 为空表示不保存.",
+	},
+	cli.DurationFlag{
+		Name:  "state-interval",
+		Value: 10 * time.Second,
+		Usage: "自定义 - 状态文件保存间隔.",
+	},
+	cli.Float64Flag{
+		Name:  "verify.pct",
+		Value: 0,
+		Usage: "自定义 - 读回校验抽样百分比(0~100), 校验对象大小和MD5, 0表示不校验.",
+	},
+	cli.DurationFlag{
+		Name:  "verify.delay",
+		Value: 10 * time.Minute,
+		Usage: "自定义 - 写入后延迟再次读回校验的时间, 0表示只在写入后立即校验一次.",
+	},
+	cli.StringFlag{
+		Name:  "sim.start",
+		Value: video.DefaultSimStart,
+		Usage: "自定义 - 模拟时钟起始日期(2006-01-02), 对象按日期分目录.",
+	},
+	cli.Float64Flag{
+		Name:  "sim.speedup",
+		Value: 1,
+		Usage: "自定义 - 模拟时钟加速倍数, 如24表示1小时写入1天的视频数据, 用于快速回放保留周期内的目录变化.",
+	},
+	cli.DurationFlag{
+		Name:  "capacity.interval",
+		Value: 0,
+		Usage: "自定义 - 已用容量采样间隔, 如 1m, 超过安全水位(加每路视频一个对象的余量)时限流, 0表示不监控.",
+	},
+	cli.StringFlag{
+		Name:  "capacity.source",
+		Value: s3worker.CapacitySourceUsage,
+		Usage: "自定义 - 已用容量统计来源: usage-集群数据用量(madmin DataUsageInfo), list-列举本次写入的对象.",
+	},
+	cli.StringFlag{
+		Name:  "capacity.action",
+		Value: s3worker.CapacityActionSkip,
+		Usage: "自定义 - 超过安全水位后的处理: skip-跳过写入(丢弃期间产生的对象, 数据预埋阶段暂停写入), delete-加速删除.",
+	},
+	cli.IntFlag{
+		Name:  "concurrent",
+		Value: 0,
+		Usage: "自定义 - 所有视频写入的全局并发上限, 0表示不限制.",
+	},
+	cli.IntFlag{
+		Name:  "playback.readers",
+		Value: 0,
+		Usage: "自定义 - 回放读并发数, 与写入同时进行, 模拟播放器按顺序范围读取视频对象, 0表示不回放.",
+	},
+	cli.Float64Flag{
+		Name:  "playback.live-pct",
+		Value: 20,
+		Usage: "自定义 - 直播回放(读最新写入的对象)的百分比(0~100), 其余为历史回放.",
+	},
+	cli.IntFlag{
+		Name:  "playback.objects",
+		Value: 10,
+		Usage: "自定义 - 每次回放连续读取的对象数.",
+	},
+	cli.StringFlag{
+		Name:  "playback.range",
+		Value: "1MiB",
+		Usage: "自定义 - 回放时每次范围读取的大小.",
+	},
+	cli.StringFlag{
+		Name:  "lock.mode",
+		Value: "",
+		Usage: "自定义 - 对象锁定保留模式: GOVERNANCE, COMPLIANCE, 每个对象按保留期限设置保留, 自动开启 bucket-lock; 为空表示不设置.",
+	},
+	cli.Float64Flag{
+		Name:  "lock.legal-hold-pct",
+		Value: 0,
+		Usage: "自定义 - 设置合法保留(模拟证据视频)的对象百分比(0~100), 删除被拒绝时单独统计.",
+	},
+	cli.StringFlag{
+		Name:  "retention",
+		Value: video.RetentionClient,
+		Usage: "自定义 - 数据保留方式: client-客户端删除超过保留期限的对象, lifecycle-为每个视频桶设置按保留期限(向上取整到天)过期的生命周期规则, 客户端不删除.",
+	},
+	cli.DurationFlag{
+		Name:  "expiry.interval",
+		Value: 10 * time.Minute,
+		Usage: "自定义 - lifecycle 保留方式下, 检查对象是否按期过期的间隔, 0表示不检查.",
+	},
 	cli.IntFlag{
 		Name:  "process-workers",
 		Value: 8,
 		Usage: "自定义 - 多进程运行协程，进程数.",
 	},
-	cli.IntFlag{
+	cli.DurationFlag{
 		Name:  "duration",
 		Value: 0,
-		Usage: "自定义 - 指定持续执行时间, 0-代表永久.",
+		Usage: "自定义 - 指定持续执行时间, 如 30m, 72h; 0-代表永久, 直到收到中断信号, 此时操作记录按周期写入分块文件.",
+	},
+	cli.DurationFlag{
+		Name:  "report.interval",
+		Value: time.Hour,
+		Usage: "自定义 - 永久运行时周期报告的间隔, 如 1h, 24h, 每个周期输出吞吐、时延分位数、错误和容量, 0表示不输出.",
 	},
 }
 
@@ -148,7 +286,7 @@ var videoS3Cmd = cli.Command{
 	Usage:  "video scene test: S3",
 	Action: mainVideo,
 	Before: setGlobalsFromContext,
-	Flags:  combineFlags(aliasFlags, videoBaseFlags, videoCustomFlags, genFlags, globalFlags),
+	Flags:  combineFlags(aliasFlags, videoBaseFlags, videoCustomFlags, spillFlags, shutdownFlags, driftFlags, retryFlags, serveFlags, genFlags, globalFlags),
 	CustomHelpTemplate: `NAME:
   {{.HelpName}} - {{.Usage}}
 
@@ -177,8 +315,91 @@ func mainVideo(ctx *cli.Context) error {
 	// 检查参数
 	checkVideoSyntax(ctx)
 
-	// 初始化参数
-	capacity, _ := humanize.ParseBytes(ctx.String("capacity"))
+	// 初始化参数，计算数据模型
+	videoInfo := newVideoInfo(ctx)
+	if err := videoInfo.CalcData(); err != nil {
+		console.Fatalln("Invalid video parameters:", err)
+	}
+	// 未指定模拟时钟参数时不使用模拟时钟
+	var clock *video.SimClock
+	if ctx.IsSet("sim.start") || ctx.IsSet("sim.speedup") {
+		var err error
+		if clock, err = video.NewSimClock(ctx.String("sim.start"), ctx.Float64("sim.speedup")); err != nil {
+			console.Fatal(err)
+		}
+	}
+
+	// 任一重试策略允许多次尝试时，重试由 Workflow 执行并记录每次尝试，关闭 S3 客户端内置的重试，
+	// 否则客户端内部的重试不会计入尝试次数和重试统计；未配置重试时保留客户端内置的重试
+	retry := retryPolicies(ctx)
+	for _, p := range retry {
+		if p.MaxAttempts > 1 {
+			minio.MaxRetry = 1
+			break
+		}
+	}
+
+	// 初始化 Workflow
+	// 随机内容的对象大小与数据模型一致：指定源文件时取源文件大小，否则取 obj.size
+	src := newGenSourceSize(ctx, strconv.FormatUint(videoInfo.FileInfo.Size, 10))
+	if ctx.Bool("file-payload") {
+		src = newFileSource(videoPayloadFiles(ctx.String("local-path")))
+	}
+	b := s3worker.VideoS3Workflow{
+		Common: workflow.Common{
+			S3Client:    s3client.NewClient(ctx),
+			Concurrency: ctx.Int("concurrent"),
+			Source:      src,
+			PutOpts:     videoPutOpts(ctx),
+			Locking:     ctx.Bool("bucket-lock") || ctx.String("lock.mode") != "" || ctx.Float64("lock.legal-hold-pct") > 0,
+			Retry:       retry,
+		},
+		VideoWorkflow: video.VideoWorkflow{
+			VideoInfo:         videoInfo,
+			SkipStageInit:     ctx.Bool("skip-stage-init"),
+			SkipStagePrefill:  ctx.Bool("skip-stage-prefill"),
+			SingleRoot:        ctx.Bool("single-root"),
+			SingleRootName:    ctx.String("single-root.name"),
+			Resume:            ctx.Bool("resume"),
+			StateFile:         ctx.String("state-file"),
+			StateInterval:     ctx.Duration("state-interval"),
+			VerifyPct:         ctx.Float64("verify.pct"),
+			VerifyDelay:       ctx.Duration("verify.delay"),
+			CapacityInterval:  ctx.Duration("capacity.interval"),
+			CapacitySource:    ctx.String("capacity.source"),
+			CapacityAction:    ctx.String("capacity.action"),
+			PlaybackReaders:   ctx.Int("playback.readers"),
+			PlaybackLivePct:   ctx.Float64("playback.live-pct"),
+			PlaybackObjects:   ctx.Int("playback.objects"),
+			PlaybackRange:     playbackRange(ctx),
+			Retention:         ctx.String("retention"),
+			ExpiryInterval:    ctx.Duration("expiry.interval"),
+			LockMode:          strings.ToUpper(ctx.String("lock.mode")),
+			LegalHoldPct:      ctx.Float64("lock.legal-hold-pct"),
+			Clock:             clock,
+			WriteOnly:         ctx.Bool("write-only"),
+			DeleteImmediately: ctx.Bool("delete-immediately"),
+		},
+	}
+	for _, g := range videoInfo.Groups {
+		if ctx.Bool("file-payload") {
+			b.GroupSources = append(b.GroupSources, newFileSource(videoPayloadFiles(g.FileInfo.FullPath)))
+		} else {
+			b.GroupSources = append(b.GroupSources, newGenSourceSize(ctx, strconv.FormatUint(g.FileInfo.Size, 10)))
+		}
+	}
+	if b.CapacityInterval > 0 && b.CapacitySource == s3worker.CapacitySourceUsage {
+		b.AdminClient = s3client.NewAdminClient(ctx)
+	}
+	return workflow.RunWorkflow(ctx, &b)
+}
+
+// newVideoInfo 根据命令行参数（及场景文件）生成视频监控场景需求信息，未指定源文件时对象大小取 obj.size
+func newVideoInfo(ctx *cli.Context) video.VideoInfo {
+	capacity, err := humanize.ParseBytes(ctx.String("capacity"))
+	if err != nil {
+		console.Fatalln("Invalid capacity:", err)
+	}
 	videoInfo := video.VideoInfo{
 		VideoBaseInfo: video.VideoBaseInfo{
 			FileInfo: models.FileInfo{
@@ -192,40 +413,69 @@ func mainVideo(ctx *cli.Context) error {
 			SafeWaterLevel:   float32(ctx.Float64("safe-water-level")),
 			Appendable:       ctx.Bool("appendable"),
 			Segments:         ctx.Int("appendable.segments"),
+			EventRate:        float32(ctx.Float64("event.rate")),
+			EventDuration:    float32(ctx.Float64("event.duration")),
+			EventMultiplier:  float32(ctx.Float64("event.multiplier")),
+			MotionOnly:       ctx.Bool("event.motion-only"),
 			DisableMultipart: ctx.Bool("disable-multipart"),
 			SingleBucket:     ctx.Bool("single-root"),
-			SingleBucketName: ctx.Bool("single-root.name"),
+			SingleBucketName: ctx.String("single-root.name"),
 		},
 		VideoDataInfo: video.VideoDataInfo{
 			MaxWorkers: ctx.Int("max-workers"),
 		},
 		VideoCustomizeInfo: video.VideoCustomizeInfo{
-			BucketPrefix: ctx.String("bucket-prefix"),
-			ObjPrefix:    ctx.String("obj-prefix"),
-			ObjIdxStart:  ctx.Int("idx-start"),
-			ObjIdxWidth:  ctx.Int("idx-width"),
+			PrepareChannelNum: ctx.Int("prepare-channel-num"),
+			BucketPrefix:      ctx.String("bucket-prefix"),
+			ObjPrefix:         ctx.String("obj-prefix"),
+			ObjIdxStart:       ctx.Int("idx-start"),
+			ObjIdxWidth:       ctx.Int("idx-width"),
 		},
 	}
 
-	// 计算数据模型
-	videoInfo.CalcData()
+	if videoInfo.FileInfo.FullPath == "" {
+		if size, err := toSize(ctx.String("obj.size")); err == nil {
+			videoInfo.FileInfo.Size = size
+			videoInfo.FileInfo.SizeHuman = humanize.IBytes(size)
+		}
+	}
 
-	// 初始化 Workflow
-	// Logger.Debug(strings.Replace(videoInfo.FileInfo.SizeHuman, " ", "", -1))
-	src := newGenSource(ctx, "obj.size")
-	b := s3worker.VideoS3Workflow{
-		Common: workflow.Common{
-			S3Client:    s3client.NewClient(ctx),
-			Concurrency: ctx.Int("concurrent"),
-			Source:      src,
-			PutOpts:     videoPutOpts(ctx),
-			Bucket:      "test",
-		},
-		VideoWorkflow: video.VideoWorkflow{
-			VideoInfo: videoInfo,
-		},
+	if path := ctx.String("scenario"); path != "" {
+		sc, err := video.LoadScenario(path)
+		if err != nil {
+			console.Fatal(err)
+		}
+		for _, g := range sc.Groups {
+			if g.ObjSize != "" && ctx.Bool("file-payload") {
+				console.Fatalf("scenario group %s: obj_size cannot be used with --file-payload\n", g.Name)
+			}
+		}
+		sc.Apply(&videoInfo)
 	}
-	return workflow.RunWorkflow(ctx, &b)
+	return videoInfo
+}
+
+// playbackRange 回放时每次范围读取的大小
+func playbackRange(ctx *cli.Context) int64 {
+	size, err := toSize(ctx.String("playback.range"))
+	if err != nil || size == 0 {
+		console.Fatalf("Invalid playback.range: %s\n", ctx.String("playback.range"))
+	}
+	return int64(size)
+}
+
+// videoPayloadFiles 返回作为上传内容的源文件列表：指定文件或目录下的所有文件
+func videoPayloadFiles(localPath string) []string {
+	st, err := os.Stat(localPath)
+	if err != nil {
+		console.Fatal(err)
+	}
+	if !st.IsDir() {
+		return []string{localPath}
+	}
+	files := fileOps.GetDirFiles(localPath)
+	Logger.Infof("Upload payload: %d files in %s", len(files), localPath)
+	return files
 }
 
 // videoPutOpts retrieves put options from the context.
@@ -243,5 +493,35 @@ func checkVideoSyntax(ctx *cli.Context) {
 	if ctx.NArg() > 0 {
 		console.Fatal("Command takes no arguments")
 	}
+	switch ctx.String("capacity.source") {
+	case s3worker.CapacitySourceUsage, s3worker.CapacitySourceList:
+	default:
+		console.Fatalf("unknown capacity.source: %s\n", ctx.String("capacity.source"))
+	}
+	switch ctx.String("capacity.action") {
+	case s3worker.CapacityActionSkip, s3worker.CapacityActionDelete:
+	default:
+		console.Fatalf("unknown capacity.action: %s\n", ctx.String("capacity.action"))
+	}
+	switch ctx.String("retention") {
+	case video.RetentionClient:
+	case video.RetentionLifecycle:
+		if ctx.Bool("delete-immediately") {
+			console.Fatal("--delete-immediately cannot be used with --retention=lifecycle")
+		}
+	default:
+		console.Fatalf("unknown retention: %s\n", ctx.String("retention"))
+	}
+	switch mode := minio.RetentionMode(strings.ToUpper(ctx.String("lock.mode"))); {
+	case mode == "", mode.IsValid():
+	default:
+		console.Fatalf("unknown lock.mode: %s\n", ctx.String("lock.mode"))
+	}
+	if pct := ctx.Float64("lock.legal-hold-pct"); pct < 0 || pct > 100 {
+		console.Fatalf("lock.legal-hold-pct must be within 0~100, got %v\n", pct)
+	}
+	if pct := ctx.Float64("playback.live-pct"); pct < 0 || pct > 100 {
+		console.Fatalf("playback.live-pct must be within 0~100, got %v\n", pct)
+	}
 	Logger.Info(strings.Join(os.Args, " "))
 }
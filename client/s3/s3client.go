@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"io"
 	"log"
 	"math"
 	"math/rand"
@@ -11,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"stress/config"
+	"stress/pkg/bench"
 	"stress/pkg/printer"
 	"strings"
 	"sync"
@@ -148,7 +150,7 @@ func getClient(ctx *cli.Context, host string) (*minio.Client, error) {
 		Region:       ctx.String("region"),
 		BucketLookup: minio.BucketLookupAuto,
 		CustomMD5:    md5simd.NewServer().NewHash,
-		Transport:    clientTransport(ctx),
+		Transport:    inFlightTransport{rt: clientTransport(ctx)},
 	})
 	if err != nil {
 		return nil, err
@@ -162,6 +164,36 @@ func getClient(ctx *cli.Context, host string) (*minio.Client, error) {
 	return cl, nil
 }
 
+// Requests counts the requests of all clients in progress.
+var Requests bench.InFlight
+
+// inFlightTransport counts requests in Requests until the response body is closed.
+type inFlightTransport struct {
+	rt http.RoundTripper
+}
+
+func (t inFlightTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done := Requests.Start(req.Method, req.URL.Scheme+"://"+req.URL.Host)
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		done()
+		return resp, err
+	}
+	resp.Body = &inFlightBody{ReadCloser: resp.Body, done: done}
+	return resp, nil
+}
+
+// inFlightBody is a response body that ends the request when closed.
+type inFlightBody struct {
+	io.ReadCloser
+	done func()
+}
+
+func (b *inFlightBody) Close() error {
+	b.done()
+	return b.ReadCloser.Close()
+}
+
 func clientTransport(ctx *cli.Context) http.RoundTripper {
 	tr := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
@@ -0,0 +1,462 @@
+/*
+ * Warp (C) 2019-2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package aggregate
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"stress/pkg/bench"
+)
+
+// DriftOptions controls the degradation analysis.
+type DriftOptions struct {
+	// Window is the length of each compared time window.
+	Window time.Duration
+	// BaselineWindows is the number of windows at the start of the run used as baseline.
+	BaselineWindows int
+	// SkipDur is skipped at the start of the run before the baseline, for example for warm-up.
+	SkipDur time.Duration
+	// MaxThroughputDrop is the tolerated relative throughput drop, 0.1 is 10%.
+	MaxThroughputDrop float64
+	// MaxLatencyRise is the tolerated relative rise of p50 and p99 latency, 0.25 is 25%.
+	MaxLatencyRise float64
+	// MaxErrorRise is the tolerated absolute rise of the error rate, 0.01 is 1 percentage point.
+	MaxErrorRise float64
+	// Sigma is the number of standard deviations a change must exceed to be significant.
+	Sigma float64
+}
+
+const (
+	defaultDriftBaseline = 3
+	defaultDriftSigma    = 3
+	// driftMinOps is the minimum number of operations in a window for it to be compared.
+	driftMinOps = 10
+	// driftMaxT caps the t statistic of a trend. An exact fit has no error,
+	// and an infinite t statistic cannot be encoded as JSON.
+	driftMaxT = 1000
+)
+
+func (o *DriftOptions) setDefaults() {
+	if o.BaselineWindows <= 0 {
+		o.BaselineWindows = defaultDriftBaseline
+	}
+	if o.Sigma <= 0 {
+		o.Sigma = defaultDriftSigma
+	}
+}
+
+// DriftWindow contains the statistics of a single operation type in a time window.
+type DriftWindow struct {
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	Ops       int64         `json:"ops"`
+	Errors    int64         `json:"errors"`
+	BPS       float64       `json:"bytes_per_sec"`
+	OPS       float64       `json:"obj_per_sec"`
+	P50       time.Duration `json:"p50"`
+	P99       time.Duration `json:"p99"`
+	Baseline  bool          `json:"baseline,omitempty"`
+	Offending []string      `json:"offending,omitempty"`
+}
+
+// ErrorRate returns the fraction of failed operations.
+func (w DriftWindow) ErrorRate() float64 {
+	if w.Ops == 0 {
+		return 0
+	}
+	return float64(w.Errors) / float64(w.Ops)
+}
+
+func (w DriftWindow) String() string {
+	s := fmt.Sprintf("%s - %s: %s, %d ops, %.2f%% errors, p50 %v, p99 %v",
+		w.Start.Format("2006-01-02 15:04:05"), w.End.Format("15:04:05"), BPSorOPS(w.BPS, w.OPS),
+		w.Ops, 100*w.ErrorRate(), w.P50.Round(time.Millisecond), w.P99.Round(time.Millisecond))
+	if len(w.Offending) > 0 {
+		s += ". " + strings.Join(w.Offending, ", ")
+	}
+	return s
+}
+
+// DriftWindowFromPeriod returns the window of a period summary of a running benchmark.
+func DriftWindowFromPeriod(p bench.PeriodSummary) DriftWindow {
+	return DriftWindow{
+		Start:  p.Start,
+		End:    p.End,
+		Ops:    p.Ops,
+		Errors: p.Errors,
+		BPS:    float64(p.Throughput()),
+		OPS:    p.ObjsPerSec(),
+		P50:    p.P50,
+		P99:    p.P99,
+	}
+}
+
+// DriftTrend is a linear trend of a latency over all windows.
+type DriftTrend struct {
+	Metric string `json:"metric"`
+	// PerHour is the relative change per hour compared to the baseline.
+	PerHour float64 `json:"per_hour"`
+	// T is the t statistic of the slope.
+	T         float64 `json:"t"`
+	Offending bool    `json:"offending"`
+}
+
+func (t DriftTrend) String() string {
+	return fmt.Sprintf("%s trend %+.2f%% per hour (t=%.1f)", t.Metric, 100*t.PerHour, t.T)
+}
+
+// DriftOp contains the degradation analysis of a single operation type.
+type DriftOp struct {
+	Type string `json:"type"`
+	// Baseline is the aggregated baseline, if analyzed offline.
+	Baseline *Operation    `json:"baseline,omitempty"`
+	Windows  []DriftWindow `json:"windows"`
+	Trends   []DriftTrend  `json:"trends,omitempty"`
+	Degraded bool          `json:"degraded"`
+}
+
+// DriftReport contains the degradation analysis of a run.
+type DriftReport struct {
+	Window time.Duration `json:"window"`
+	Ops    []DriftOp     `json:"operations"`
+	Pass   bool          `json:"pass"`
+}
+
+// Drift compares each window of the run to a baseline at the start of the run,
+// and flags significant drift of throughput, p50/p99 latency and error rate.
+func Drift(o bench.Operations, opts DriftOptions) DriftReport {
+	opts.setDefaults()
+	rep := DriftReport{Window: opts.Window, Pass: true}
+	if opts.Window <= 0 {
+		return rep
+	}
+	types := o.OpTypes()
+	res := make([]DriftOp, len(types))
+	var wg sync.WaitGroup
+	wg.Add(len(types))
+	for i := range types {
+		go func(i int) {
+			defer wg.Done()
+			ops := o.FilterByOp(types[i])
+			if opts.SkipDur > 0 {
+				start, end := ops.TimeRange()
+				ops = ops.FilterInsideRange(start.Add(opts.SkipDur), end)
+			}
+			d := compareDrift(types[i], driftWindows(ops, opts.Window), opts)
+			if len(d.Windows) >= opts.BaselineWindows {
+				base := ops.FilterInsideRange(d.Windows[0].Start, d.Windows[opts.BaselineWindows-1].End)
+				aggr := Aggregate(base, Options{DurFunc: func(total time.Duration) time.Duration { return total / 10 }})
+				if len(aggr.Operations) == 1 {
+					d.Baseline = &aggr.Operations[0]
+				}
+			}
+			res[i] = d
+		}(i)
+	}
+	wg.Wait()
+	rep.Ops = res
+	for _, d := range res {
+		rep.Pass = rep.Pass && !d.Degraded
+	}
+	return rep
+}
+
+// driftWindows splits operations of a single type into windows.
+func driftWindows(ops bench.Operations, window time.Duration) []DriftWindow {
+	segs := ops.Segment(bench.SegmentOptions{PerSegDuration: window})
+	ops.SortByEndTime()
+	res := make([]DriftWindow, 0, len(segs))
+	for _, seg := range segs {
+		// Latency and errors of operations ending in the window.
+		from := sort.Search(len(ops), func(i int) bool { return !ops[i].End.Before(seg.Start) })
+		to := sort.Search(len(ops), func(i int) bool { return !ops[i].End.Before(seg.EndsBefore) })
+		in := append(bench.Operations(nil), ops[from:to]...)
+		mib, _, objs := seg.SpeedPerSec()
+		w := DriftWindow{
+			Start:  seg.Start,
+			End:    seg.EndsBefore,
+			Ops:    int64(len(in)),
+			Errors: int64(len(in.FilterErrors())),
+			BPS:    math.Round(mib * (1 << 20)),
+			OPS:    objs,
+		}
+		ok := in.FilterSuccessful()
+		ok.SortByDuration()
+		if len(ok) > 0 {
+			w.P50 = ok.Median(0.5).Duration()
+			w.P99 = ok.Median(0.99).Duration()
+		}
+		res = append(res, w)
+	}
+	return res
+}
+
+// driftBaseline contains the mean and standard deviation of the baseline windows.
+type driftBaseline struct {
+	bps, ops, p50, p99 meanDev
+	usesBPS            bool
+	errRate            float64
+	n                  int64
+}
+
+type meanDev struct{ mean, dev float64 }
+
+func newMeanDev(v []float64) meanDev {
+	var m meanDev
+	if len(v) == 0 {
+		return m
+	}
+	for _, x := range v {
+		m.mean += x
+	}
+	m.mean /= float64(len(v))
+	if len(v) > 1 {
+		for _, x := range v {
+			m.dev += (x - m.mean) * (x - m.mean)
+		}
+		m.dev = math.Sqrt(m.dev / float64(len(v)-1))
+	}
+	return m
+}
+
+// rise returns whether v is higher than the mean by more than the relative tolerance and sigma deviations.
+func (m meanDev) rise(v, tolerance, sigma float64) bool {
+	return m.mean > 0 && v > m.mean*(1+tolerance) && v-m.mean > sigma*m.dev
+}
+
+// drop returns whether v is lower than the mean by more than the relative tolerance and sigma deviations.
+func (m meanDev) drop(v, tolerance, sigma float64) bool {
+	return m.mean > 0 && v < m.mean*(1-tolerance) && m.mean-v > sigma*m.dev
+}
+
+func newDriftBaseline(windows []DriftWindow) driftBaseline {
+	var b driftBaseline
+	var bps, ops, p50, p99 []float64
+	var errs int64
+	for _, w := range windows {
+		bps = append(bps, w.BPS)
+		ops = append(ops, w.OPS)
+		p50 = append(p50, float64(w.P50))
+		p99 = append(p99, float64(w.P99))
+		errs += w.Errors
+		b.n += w.Ops
+	}
+	b.bps, b.ops, b.p50, b.p99 = newMeanDev(bps), newMeanDev(ops), newMeanDev(p50), newMeanDev(p99)
+	b.usesBPS = b.bps.mean > 0
+	if b.n > 0 {
+		b.errRate = float64(errs) / float64(b.n)
+	}
+	return b
+}
+
+// compare returns the reasons the window is degraded compared to the baseline.
+func (b driftBaseline) compare(w DriftWindow, opts DriftOptions) []string {
+	if w.Ops < driftMinOps {
+		return nil
+	}
+	var res []string
+	if b.usesBPS {
+		if b.bps.drop(w.BPS, opts.MaxThroughputDrop, opts.Sigma) {
+			res = append(res, fmt.Sprintf("throughput %s below baseline %s", bench.Throughput(w.BPS), bench.Throughput(b.bps.mean)))
+		}
+	} else if b.ops.drop(w.OPS, opts.MaxThroughputDrop, opts.Sigma) {
+		res = append(res, fmt.Sprintf("throughput %.2f obj/s below baseline %.2f obj/s", w.OPS, b.ops.mean))
+	}
+	if b.p50.rise(float64(w.P50), opts.MaxLatencyRise, opts.Sigma) {
+		res = append(res, fmt.Sprintf("p50 %v above baseline %v", w.P50.Round(time.Millisecond), time.Duration(b.p50.mean).Round(time.Millisecond)))
+	}
+	if b.p99.rise(float64(w.P99), opts.MaxLatencyRise, opts.Sigma) {
+		res = append(res, fmt.Sprintf("p99 %v above baseline %v", w.P99.Round(time.Millisecond), time.Duration(b.p99.mean).Round(time.Millisecond)))
+	}
+	// Two-proportion z-test of the error rate.
+	if rate := w.ErrorRate(); rate-b.errRate > opts.MaxErrorRise && b.n > 0 {
+		pooled := (b.errRate*float64(b.n) + float64(w.Errors)) / float64(b.n+w.Ops)
+		se := math.Sqrt(pooled * (1 - pooled) * (1/float64(b.n) + 1/float64(w.Ops)))
+		if se == 0 || (rate-b.errRate)/se > opts.Sigma {
+			res = append(res, fmt.Sprintf("error rate %.2f%% above baseline %.2f%%", 100*rate, 100*b.errRate))
+		}
+	}
+	return res
+}
+
+// compareDrift compares the windows after the baseline to the baseline and fits the latency trends.
+func compareDrift(typ string, windows []DriftWindow, opts DriftOptions) DriftOp {
+	d := DriftOp{Type: typ, Windows: windows}
+	if len(windows) <= opts.BaselineWindows {
+		return d
+	}
+	base := newDriftBaseline(windows[:opts.BaselineWindows])
+	for i := range d.Windows {
+		w := &d.Windows[i]
+		if i < opts.BaselineWindows {
+			w.Baseline = true
+			continue
+		}
+		w.Offending = base.compare(*w, opts)
+		d.Degraded = d.Degraded || len(w.Offending) > 0
+	}
+	for _, m := range []struct {
+		name string
+		base float64
+		get  func(w DriftWindow) time.Duration
+	}{
+		{"p50", base.p50.mean, func(w DriftWindow) time.Duration { return w.P50 }},
+		{"p99", base.p99.mean, func(w DriftWindow) time.Duration { return w.P99 }},
+	} {
+		t, ok := driftTrend(d.Windows, m.base, m.get)
+		if !ok {
+			continue
+		}
+		t.Metric = m.name
+		// A slow creep is offending when it is significant and adds up to more than the tolerance over the run.
+		span := d.Windows[len(d.Windows)-1].End.Sub(d.Windows[0].Start).Hours()
+		t.Offending = t.T > opts.Sigma && t.PerHour*span > opts.MaxLatencyRise
+		d.Degraded = d.Degraded || t.Offending
+		d.Trends = append(d.Trends, t)
+	}
+	return d
+}
+
+// driftTrend fits a least squares line through the latencies of the windows.
+func driftTrend(windows []DriftWindow, base float64, get func(w DriftWindow) time.Duration) (DriftTrend, bool) {
+	var xs, ys []float64
+	for _, w := range windows {
+		if w.Ops < driftMinOps {
+			continue
+		}
+		xs = append(xs, w.Start.Sub(windows[0].Start).Hours())
+		ys = append(ys, float64(get(w)))
+	}
+	n := float64(len(xs))
+	if len(xs) < 3 || base <= 0 {
+		return DriftTrend{}, false
+	}
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx, my = mx/n, my/n
+	var sxx, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - mx) * (xs[i] - mx)
+		sxy += (xs[i] - mx) * (ys[i] - my)
+	}
+	if sxx == 0 {
+		return DriftTrend{}, false
+	}
+	slope := sxy / sxx
+	var sse float64
+	for i := range xs {
+		r := ys[i] - (my + slope*(xs[i]-mx))
+		sse += r * r
+	}
+	t := DriftTrend{PerHour: slope / base}
+	if se := math.Sqrt(sse / (n - 2) / sxx); se > 0 {
+		t.T = math.Max(-driftMaxT, math.Min(driftMaxT, slope/se))
+	} else if slope != 0 {
+		t.T = math.Copysign(driftMaxT, slope)
+	}
+	return t, true
+}
+
+// String returns the report with the verdict on the last line.
+func (r DriftReport) String() string {
+	var sb strings.Builder
+	for _, d := range r.Ops {
+		fmt.Fprintf(&sb, "Operation %s, %d windows of %v", d.Type, len(d.Windows), r.Window)
+		if d.Baseline != nil {
+			fmt.Fprintf(&sb, ", baseline %v", d.Baseline.Throughput.StringDetails(false))
+		}
+		sb.WriteString(":\n")
+		for _, w := range d.Windows {
+			switch {
+			case w.Baseline:
+				sb.WriteString(" * Baseline " + w.String() + "\n")
+			case len(w.Offending) > 0:
+				sb.WriteString(" * DEGRADED " + w.String() + "\n")
+			}
+		}
+		for _, t := range d.Trends {
+			mark := " * "
+			if t.Offending {
+				mark = " * DEGRADED "
+			}
+			sb.WriteString(mark + t.String() + "\n")
+		}
+		if !d.Degraded {
+			sb.WriteString(" * No degradation.\n")
+		}
+	}
+	if r.Pass {
+		sb.WriteString("Degradation check: PASS")
+	} else {
+		sb.WriteString("Degradation check: FAIL")
+	}
+	return sb.String()
+}
+
+// DriftDetector compares the windows of a running benchmark to a baseline at the start of the run.
+type DriftDetector struct {
+	opts    DriftOptions
+	mu      sync.Mutex
+	types   []string
+	windows map[string][]DriftWindow
+}
+
+// NewDriftDetector returns a detector for windows added while the benchmark runs.
+func NewDriftDetector(opts DriftOptions) *DriftDetector {
+	opts.setDefaults()
+	return &DriftDetector{opts: opts, windows: make(map[string][]DriftWindow)}
+}
+
+// Add adds the next window of the operation type and returns it,
+// with the reasons it is degraded compared to the baseline, if any.
+func (d *DriftDetector) Add(typ string, w DriftWindow) DriftWindow {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ws, ok := d.windows[typ]
+	if !ok {
+		d.types = append(d.types, typ)
+	}
+	if len(ws) < d.opts.BaselineWindows {
+		w.Baseline = true
+	} else {
+		w.Offending = newDriftBaseline(ws[:d.opts.BaselineWindows]).compare(w, d.opts)
+	}
+	d.windows[typ] = append(ws, w)
+	return w
+}
+
+// Report returns the analysis of all windows added so far.
+func (d *DriftDetector) Report() DriftReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rep := DriftReport{Window: d.opts.Window, Pass: true}
+	for _, typ := range d.types {
+		op := compareDrift(typ, d.windows[typ], d.opts)
+		rep.Pass = rep.Pass && !op.Degraded
+		rep.Ops = append(rep.Ops, op)
+	}
+	return rep
+}
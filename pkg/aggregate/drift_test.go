@@ -0,0 +1,106 @@
+/*
+ * Warp (C) 2019-2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package aggregate
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"stress/pkg/bench"
+)
+
+// driftOps returns 20 minutes of PUT operations, 10 per second on each of 4 threads.
+// After 10 minutes latency rises by lateRise for each following minute.
+func driftOps(lateRise time.Duration) bench.Operations {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	var ops bench.Operations
+	for thread := uint16(0); thread < 4; thread++ {
+		for i := 0; i < 20*60*10; i++ {
+			s := start.Add(time.Duration(i) * 100 * time.Millisecond)
+			d := 50*time.Millisecond + time.Duration(i%7)*time.Millisecond
+			if m := s.Sub(start) / time.Minute; m >= 10 {
+				d += time.Duration(m-9) * lateRise
+			}
+			ops = append(ops, bench.Operation{OpType: "PUT", Thread: thread, ObjPerOp: 1, Size: 1 << 20, Start: s, End: s.Add(d), File: "obj"})
+		}
+	}
+	ops.SortByStartTime()
+	return ops
+}
+
+func TestDrift(t *testing.T) {
+	opts := DriftOptions{Window: time.Minute, MaxThroughputDrop: 0.1, MaxLatencyRise: 0.25, MaxErrorRise: 0.01}
+	rep := Drift(driftOps(0), opts)
+	if !rep.Pass || len(rep.Ops) != 1 || len(rep.Ops[0].Windows) < 15 || rep.Ops[0].Baseline == nil {
+		t.Fatalf("steady run should pass: %s", rep)
+	}
+
+	rep = Drift(driftOps(5*time.Millisecond), opts)
+	if rep.Pass {
+		t.Fatalf("creeping latency should fail: %s", rep)
+	}
+	var offending int
+	for _, w := range rep.Ops[0].Windows {
+		if len(w.Offending) > 0 {
+			offending++
+			if w.Start.Minute() < 10 {
+				t.Errorf("window before the latency rise flagged: %v", w)
+			}
+		}
+	}
+	if offending == 0 {
+		t.Errorf("no offending windows: %s", rep)
+	}
+}
+
+func TestDriftDetector(t *testing.T) {
+	d := NewDriftDetector(DriftOptions{Window: time.Minute, MaxThroughputDrop: 0.1, MaxLatencyRise: 0.25, MaxErrorRise: 0.01})
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		p := bench.PeriodSummary{OpType: "PUT", Start: start.Add(time.Duration(i) * time.Minute), Ops: 1000, Objects: 1000, Bytes: 1000 << 20,
+			P50: 50*time.Millisecond + time.Duration(i%2)*time.Millisecond, P99: 80 * time.Millisecond}
+		if i == 5 {
+			p.Errors = 100
+		}
+		p.End = p.Start.Add(time.Minute)
+		w := d.Add(p.OpType, DriftWindowFromPeriod(p))
+		if (len(w.Offending) > 0) != (i == 5) {
+			t.Errorf("window %d: unexpected offending %v", i, w.Offending)
+		}
+	}
+	if d.Report().Pass {
+		t.Error("want failed drift check")
+	}
+}
+
+func TestDriftTrendExactFit(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	var windows []DriftWindow
+	for i := 0; i < 5; i++ {
+		s := start.Add(time.Duration(i) * time.Hour)
+		windows = append(windows, DriftWindow{Start: s, End: s.Add(time.Hour), Ops: 1000, P50: time.Duration(50+i) * time.Millisecond})
+	}
+	tr, ok := driftTrend(windows, float64(50*time.Millisecond), func(w DriftWindow) time.Duration { return w.P50 })
+	if !ok || tr.T != driftMaxT {
+		t.Fatalf("want capped t statistic, got %+v", tr)
+	}
+	if _, err := json.Marshal(tr); err != nil {
+		t.Fatal(err)
+	}
+}
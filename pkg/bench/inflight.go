@@ -0,0 +1,79 @@
+/*
+ * Warp (C) 2019-2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bench
+
+import (
+	"sort"
+	"sync"
+)
+
+// InFlightKey identifies requests of a method to an endpoint.
+type InFlightKey struct {
+	Method   string
+	Endpoint string
+}
+
+// InFlight counts requests in progress.
+// The zero value is ready to use.
+type InFlight struct {
+	mu sync.Mutex
+	n  map[InFlightKey]int64
+}
+
+// Start counts a request as in progress until the returned function is called.
+func (f *InFlight) Start(method, endpoint string) (done func()) {
+	k := InFlightKey{Method: method, Endpoint: endpoint}
+	f.mu.Lock()
+	if f.n == nil {
+		f.n = make(map[InFlightKey]int64)
+	}
+	f.n[k]++
+	f.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			f.mu.Lock()
+			f.n[k]--
+			f.mu.Unlock()
+		})
+	}
+}
+
+// InFlightCount is the number of requests in progress of a method to an endpoint.
+type InFlightCount struct {
+	InFlightKey
+	N int64
+}
+
+// Counts returns the requests in progress of every method and endpoint seen,
+// sorted by endpoint and method.
+func (f *InFlight) Counts() []InFlightCount {
+	f.mu.Lock()
+	res := make([]InFlightCount, 0, len(f.n))
+	for k, n := range f.n {
+		res = append(res, InFlightCount{InFlightKey: k, N: n})
+	}
+	f.mu.Unlock()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Endpoint != res[j].Endpoint {
+			return res[i].Endpoint < res[j].Endpoint
+		}
+		return res[i].Method < res[j].Method
+	})
+	return res
+}
@@ -0,0 +1,206 @@
+/*
+ * Warp (C) 2019-2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bench
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ThreadLag contains the schedule lag of the scheduled operations of a single channel,
+// or of a single thread for operations without a channel.
+type ThreadLag struct {
+	ClientID string        `json:"client_id"`
+	Channel  string        `json:"channel,omitempty"`
+	Thread   uint16        `json:"thread"`
+	Ops      int           `json:"ops"`
+	Missed   int           `json:"missed"`
+	AvgLag   time.Duration `json:"avg_lag"`
+	MaxLag   time.Duration `json:"max_lag"`
+}
+
+// LagSummary contains the schedule lag of all operations with a due time.
+type LagSummary struct {
+	// OpType is set when the summary only covers a single operation type.
+	OpType string        `json:"op_type,omitempty"`
+	Ops    int           `json:"ops"`
+	Missed int           `json:"missed"`
+	AvgLag time.Duration `json:"avg_lag"`
+	MaxLag time.Duration `json:"max_lag"`
+	// Channels, or threads of operations without a channel, with scheduled operations, worst first.
+	Threads []ThreadLag `json:"threads"`
+}
+
+// lagKey identifies a channel, or a thread for operations without a channel.
+type lagKey struct {
+	client  string
+	channel string
+	thread  uint16
+}
+
+// lagTotals contains running totals of the schedule lag of operations with a due time.
+type lagTotals struct {
+	s       LagSummary
+	total   time.Duration
+	threads map[lagKey]*ThreadLag
+	sums    map[lagKey]time.Duration
+}
+
+func (l *lagTotals) add(op Operation) {
+	if op.Due == nil {
+		return
+	}
+	if l.threads == nil {
+		l.threads = make(map[lagKey]*ThreadLag)
+		l.sums = make(map[lagKey]time.Duration)
+	}
+	k := lagKey{client: op.ClientID, channel: op.Channel}
+	if op.Channel == "" {
+		k.thread = op.Thread
+	}
+	lag := op.Lag()
+	t := l.threads[k]
+	if t == nil {
+		t = &ThreadLag{ClientID: op.ClientID, Channel: k.channel, Thread: k.thread, MaxLag: lag}
+		l.threads[k] = t
+	}
+	if l.s.Ops == 0 {
+		l.s.MaxLag = lag
+	}
+	l.s.Ops++
+	t.Ops++
+	l.total += lag
+	l.sums[k] += lag
+	if lag > 0 {
+		l.s.Missed++
+		t.Missed++
+	}
+	if lag > l.s.MaxLag {
+		l.s.MaxLag = lag
+	}
+	if lag > t.MaxLag {
+		t.MaxLag = lag
+	}
+}
+
+// summary returns the lag of the operations added so far.
+func (l *lagTotals) summary() LagSummary {
+	s := l.s
+	if s.Ops == 0 {
+		return s
+	}
+	s.AvgLag = l.total / time.Duration(s.Ops)
+	s.Threads = make([]ThreadLag, 0, len(l.threads))
+	for k, t := range l.threads {
+		t := *t
+		t.AvgLag = l.sums[k] / time.Duration(t.Ops)
+		s.Threads = append(s.Threads, t)
+	}
+	sort.Slice(s.Threads, func(i, j int) bool {
+		a, b := s.Threads[i], s.Threads[j]
+		if a.Missed != b.Missed {
+			return a.Missed > b.Missed
+		}
+		if a.MaxLag != b.MaxLag {
+			return a.MaxLag > b.MaxLag
+		}
+		if a.ClientID != b.ClientID {
+			return a.ClientID < b.ClientID
+		}
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+		return a.Thread < b.Thread
+	})
+	return s
+}
+
+// LagSummary returns the schedule lag of operations that have a due time.
+// An operation has missed its deadline if it ended after it was due.
+// Operations are grouped by channel, or by thread if they have no channel.
+func (o Operations) LagSummary() LagSummary {
+	var l lagTotals
+	for _, op := range o {
+		l.add(op)
+	}
+	return l.summary()
+}
+
+// LagSummaryByOp returns the schedule lag of each operation type that has
+// operations with a due time, so deadlines of different kinds of operations,
+// e.g. writes and reads, are not mixed.
+func (o Operations) LagSummaryByOp() []LagSummary {
+	var res []LagSummary
+	for _, typ := range o.OpTypes() {
+		s := o.FilterByOp(typ).LagSummary()
+		if s.Ops == 0 {
+			continue
+		}
+		s.OpType = typ
+		res = append(res, s)
+	}
+	return res
+}
+
+// LagSummaryByOp returns the schedule lag of each operation type received so far,
+// including operations that are only kept in chunk files.
+func (c *Collector) LagSummaryByOp() []LagSummary {
+	c.opsMu.Lock()
+	defer c.opsMu.Unlock()
+	var res []LagSummary
+	for typ, l := range c.lag {
+		if l.s.Ops == 0 {
+			continue
+		}
+		s := l.summary()
+		s.OpType = typ
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].OpType < res[j].OpType })
+	return res
+}
+
+// String returns a human readable summary listing at most worst channels or threads.
+func (s LagSummary) String(worst int) string {
+	var b strings.Builder
+	if s.OpType != "" {
+		fmt.Fprintf(&b, "%s ", s.OpType)
+	}
+	fmt.Fprintf(&b, "Schedule lag: %d scheduled operations, %d missed deadline (%.2f%%), avg lag: %v, max lag: %v",
+		s.Ops, s.Missed, 100*float64(s.Missed)/float64(s.Ops), s.AvgLag.Round(time.Millisecond), s.MaxLag.Round(time.Millisecond))
+	if worst > len(s.Threads) {
+		worst = len(s.Threads)
+	}
+	if worst > 0 {
+		fmt.Fprintf(&b, "\nWorst channels or threads:")
+	}
+	for _, t := range s.Threads[:worst] {
+		if t.Channel != "" {
+			fmt.Fprintf(&b, "\n * Channel %s", t.Channel)
+		} else {
+			fmt.Fprintf(&b, "\n * Thread %d", t.Thread)
+		}
+		if t.ClientID != "" {
+			fmt.Fprintf(&b, " (client %s)", t.ClientID)
+		}
+		fmt.Fprintf(&b, ": %d/%d missed, avg lag: %v, max lag: %v", t.Missed, t.Ops, t.AvgLag.Round(time.Millisecond), t.MaxLag.Round(time.Millisecond))
+	}
+	return b.String()
+}
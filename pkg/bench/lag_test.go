@@ -0,0 +1,83 @@
+/*
+ * Warp (C) 2019-2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bench
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestOperations_LagSummary(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	scheduled := func(thread uint16, n int, dur time.Duration) Operation {
+		s := start.Add(time.Duration(n) * time.Second)
+		due := s.Add(time.Second)
+		return Operation{OpType: "PUT", Thread: thread, ObjPerOp: 1, Start: s, End: s.Add(dur), Due: &due}
+	}
+	ops := Operations{
+		scheduled(0, 0, 500*time.Millisecond),
+		scheduled(0, 1, 500*time.Millisecond),
+		scheduled(1, 0, 3*time.Second),
+		scheduled(1, 1, 500*time.Millisecond),
+		{OpType: "DELETE", Thread: 1, ObjPerOp: 1, Start: start, End: start.Add(time.Hour)},
+	}
+
+	var buf bytes.Buffer
+	if err := ops.CSV(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	ops, err := OperationsFromCSV(&buf, false, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := ops.LagSummary()
+	if s.Ops != 4 || s.Missed != 1 {
+		t.Fatalf("want 4 ops, 1 missed, got %d ops, %d missed", s.Ops, s.Missed)
+	}
+	if s.MaxLag != 2*time.Second {
+		t.Errorf("want max lag 2s, got %v", s.MaxLag)
+	}
+	if len(s.Threads) != 2 || s.Threads[0].Thread != 1 || s.Threads[0].Missed != 1 {
+		t.Errorf("want thread 1 worst, got %+v", s.Threads)
+	}
+	t.Log(s.String(10))
+
+	ops = append(ops, Operation{OpType: "GET", Thread: 2, ObjPerOp: 1, Start: start, End: start.Add(2 * time.Second), Due: &start})
+	byOp := ops.LagSummaryByOp()
+	if len(byOp) != 2 || byOp[0].OpType != "GET" || byOp[0].Missed != 1 || byOp[1].OpType != "PUT" || byOp[1].Ops != 4 {
+		t.Errorf("want separate GET and PUT lag, got %+v", byOp)
+	}
+
+	// Operations of a channel are grouped together, whatever thread ran them.
+	for i := range ops {
+		ops[i].Channel = "video" + string(rune('0'+i%2))
+	}
+	buf.Reset()
+	if err := ops.CSV(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	if ops, err = OperationsFromCSV(&buf, false, 0, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	s = ops.FilterByOp("PUT").LagSummary()
+	if len(s.Threads) != 2 || s.Threads[0].Channel != "video0" || s.Threads[0].Ops != 2 || s.Threads[0].Missed != 1 {
+		t.Errorf("want channel video0 worst, got %+v", s.Threads)
+	}
+}
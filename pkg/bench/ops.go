@@ -48,34 +48,147 @@ type Operation struct {
 	Thread    uint16     `json:"thread"`
 	ClientID  string     `json:"client_id"`
 	Endpoint  string     `json:"endpoint"`
+	// Due is the time the operation was scheduled to be done by, if any.
+	Due *time.Time `json:"due,omitempty"`
+	// Attempts is the number of requests made when failed requests are retried, 0 if not retried.
+	Attempts int `json:"attempts,omitempty"`
+	// ErrClass is the class of the error, see ClassifyError.
+	// It is also set when a retry succeeded after a failed attempt.
+	ErrClass string `json:"err_class,omitempty"`
+	// Channel is the name of the stream, such as a video channel, the operation belongs to, if any.
+	// Threads may serve several channels, so schedule lag is reported by channel when set.
+	Channel string `json:"channel,omitempty"`
 }
 
 type Collector struct {
 	ops Operations
-	// The mutex protects the ops above.
+	// The mutex protects the ops and totals above.
 	// Once ops have been added, they should no longer be modified.
-	opsMu sync.Mutex
-	rcv   chan Operation
-	rcvWg sync.WaitGroup
+	opsMu  sync.Mutex
+	totals map[string]*OpTotals
+	// lag and retries contain running totals by operation type, so they can be
+	// reported when the operations are only kept in chunk files.
+	lag     map[string]*lagTotals
+	retries map[string]*retryTotals
+	rcv     chan Operation
+	rcvWg   sync.WaitGroup
+
+	// period contains the operations completed in the current report period.
+	period      map[string]*periodTotals
+	periodStart time.Time
+
+	// stopped is set when Stop has been called. Operations received after that are discarded.
+	stopped bool
+
+	// spill writes the operations to chunk files, if set.
+	// Only the most recent operations are then kept in ops.
+	spill *spillWriter
+
+	// observers are notified of every operation added.
+	observers []OpObserver
+}
+
+// OpObserver is notified of every operation added to a collector,
+// for example to update live metrics while the benchmark is running.
+type OpObserver interface {
+	// Observe is called with each operation as it is added.
+	// Calls are made from a single goroutine and must not block.
+	Observe(op Operation)
+}
+
+// AddObserver adds an observer that is notified of operations added from now on.
+func (c *Collector) AddObserver(o OpObserver) {
+	c.opsMu.Lock()
+	c.observers = append(c.observers, o)
+	c.opsMu.Unlock()
 }
 
 func NewCollector() *Collector {
+	return newCollector(nil)
+}
+
+func newCollector(spill *spillWriter) *Collector {
 	r := &Collector{
-		ops: make(Operations, 0, 10000),
-		rcv: make(chan Operation, 1000),
+		ops:     make(Operations, 0, 10000),
+		totals:  make(map[string]*OpTotals),
+		lag:     make(map[string]*lagTotals),
+		retries: make(map[string]*retryTotals),
+		rcv:     make(chan Operation, 1000),
+		spill:   spill,
+
+		period:      make(map[string]*periodTotals),
+		periodStart: time.Now(),
 	}
 	r.rcvWg.Add(1)
 	go func() {
 		defer r.rcvWg.Done()
 		for op := range r.rcv {
 			r.opsMu.Lock()
-			r.ops = append(r.ops, op)
+			if r.stopped {
+				r.opsMu.Unlock()
+				continue
+			}
+			if r.spill != nil {
+				r.spill.write(op)
+			}
+			r.add(op)
 			r.opsMu.Unlock()
 		}
 	}()
 	return r
 }
 
+// add the operation to the totals and the kept operations.
+// Must be called with opsMu held.
+func (c *Collector) add(op Operation) {
+	t := c.totals[op.OpType]
+	if t == nil {
+		t = &OpTotals{OpType: op.OpType}
+		c.totals[op.OpType] = t
+	}
+	t.add(op)
+	l := c.lag[op.OpType]
+	if l == nil {
+		l = &lagTotals{}
+		c.lag[op.OpType] = l
+	}
+	l.add(op)
+	r := c.retries[op.OpType]
+	if r == nil {
+		r = &retryTotals{}
+		c.retries[op.OpType] = r
+	}
+	r.add(op)
+	p := c.period[op.OpType]
+	if p == nil {
+		p = &periodTotals{}
+		c.period[op.OpType] = p
+	}
+	p.add(op)
+	for _, o := range c.observers {
+		o.Observe(op)
+	}
+	if c.spill != nil && len(c.ops) >= 2*c.spill.opts.Keep {
+		// Drop the oldest half. Existing slices handed out stay untouched.
+		keep := make(Operations, c.spill.opts.Keep, cap(c.ops))
+		copy(keep, c.ops[len(c.ops)-c.spill.opts.Keep:])
+		c.ops = keep
+	}
+	c.ops = append(c.ops, op)
+}
+
+// Totals returns the running totals of all operations received so far, sorted by operation type.
+func (c *Collector) Totals() []OpTotals {
+	c.opsMu.Lock()
+	defer c.opsMu.Unlock()
+	res := make([]OpTotals, 0, len(c.totals))
+	for _, t := range c.totals {
+		res = append(res, *t)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].OpType < res[j].OpType })
+	return res
+}
+
 // AutoTerm will check if throughput is within 'threshold' (0 -> ) for wantSamples,
 // when the current operations are split into 'splitInto' segments.
 // The minimum duration for the calculation can be set as well.
@@ -156,12 +269,32 @@ func (c *Collector) Receiver() chan<- Operation {
 	return c.rcv
 }
 
+// Close stops receiving operations and returns the collected operations.
+// When spilling to chunk files, only the most recent operations are returned
+// and the complete set must be read back from the files returned by Spilled.
 func (c *Collector) Close() Operations {
 	close(c.rcv)
 	c.rcvWg.Wait()
+	c.opsMu.Lock()
+	defer c.opsMu.Unlock()
+	if c.spill != nil {
+		c.spill.close()
+	}
 	return c.ops
 }
 
+// Stop stops collecting without waiting for the senders, and returns a copy of the operations collected so far.
+// Operations received after that are discarded. Chunk files are completed, so they can be analyzed.
+func (c *Collector) Stop() Operations {
+	c.opsMu.Lock()
+	defer c.opsMu.Unlock()
+	c.stopped = true
+	if c.spill != nil {
+		c.spill.close()
+	}
+	return append(Operations(nil), c.ops...)
+}
+
 // Duration returns the duration o.End-o.Start
 func (o Operation) Duration() time.Duration {
 	return o.End.Sub(o.Start)
@@ -291,6 +424,15 @@ func (o Operation) TTFB() time.Duration {
 	return o.FirstByte.Sub(o.Start)
 }
 
+// Lag returns how long after the due time the operation ended.
+// Negative values mean it ended before it was due, 0 if no due time was recorded.
+func (o Operation) Lag() time.Duration {
+	if o.Due == nil {
+		return 0
+	}
+	return o.End.Sub(*o.Due)
+}
+
 // SortByStartTime will sort the operations by start time.
 // Earliest operations first.
 func (o Operations) SortByStartTime() {
@@ -986,37 +1128,56 @@ func (o Operations) FilterErrors() Operations {
 	return errs
 }
 
+// csvHeader is the header line of operations written as CSV.
+const csvHeader = "idx\tthread\top\tclient_id\tn_objects\tbytes\tendpoint\tfile\terror\tstart\tfirst_byte\tend\tduration_ns\tdue\tlag_ns\tattempts\terr_class\tchannel\n"
+
 // CSV will write the operations to w as CSV.
 // The comment, if any, is written at the end of the file, each line prefixed with '# '.
 func (o Operations) CSV(w io.Writer, comment string) error {
 	bw := bufio.NewWriter(w)
-	_, err := bw.WriteString("idx\tthread\top\tclient_id\tn_objects\tbytes\tendpoint\tfile\terror\tstart\tfirst_byte\tend\tduration_ns\n")
+	_, err := bw.WriteString(csvHeader)
 	if err != nil {
 		return err
 	}
 	for i, op := range o {
-		var ttfb string
-		if op.FirstByte != nil {
-			ttfb = op.FirstByte.Format(time.RFC3339Nano)
-		}
-		_, err := fmt.Fprintf(bw, "%d\t%d\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", i, op.Thread, op.OpType, op.ClientID, op.ObjPerOp, op.Size, csvEscapeString(op.Endpoint), op.File, csvEscapeString(op.Err), op.Start.Format(time.RFC3339Nano), ttfb, op.End.Format(time.RFC3339Nano), op.End.Sub(op.Start)/time.Nanosecond)
-		if err != nil {
+		if err := op.writeCSV(bw, i); err != nil {
 			return err
 		}
 	}
-	if len(comment) > 0 {
-		lines := strings.Split(comment, "\n")
-		for _, txt := range lines {
-			_, err := bw.WriteString("# " + txt + "\n")
-			if err != nil {
-				return err
-			}
-		}
+	if err := writeCSVComment(bw, comment); err != nil {
+		return err
 	}
-
 	return bw.Flush()
 }
 
+// writeCSV writes the operation as a single CSV line with index i.
+func (op Operation) writeCSV(w io.Writer, i int) error {
+	var ttfb string
+	if op.FirstByte != nil {
+		ttfb = op.FirstByte.Format(time.RFC3339Nano)
+	}
+	var due, lag string
+	if op.Due != nil {
+		due = op.Due.Format(time.RFC3339Nano)
+		lag = strconv.FormatInt(int64(op.Lag()), 10)
+	}
+	_, err := fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%d\t%s\t%s\n", i, op.Thread, op.OpType, op.ClientID, op.ObjPerOp, op.Size, csvEscapeString(op.Endpoint), op.File, csvEscapeString(op.Err), op.Start.Format(time.RFC3339Nano), ttfb, op.End.Format(time.RFC3339Nano), op.End.Sub(op.Start)/time.Nanosecond, due, lag, op.Attempts, op.ErrClass, csvEscapeString(op.Channel))
+	return err
+}
+
+// writeCSVComment writes the comment, if any, each line prefixed with '# '.
+func writeCSVComment(w io.StringWriter, comment string) error {
+	if len(comment) == 0 {
+		return nil
+	}
+	for _, txt := range strings.Split(comment, "\n") {
+		if _, err := w.WriteString("# " + txt + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // OperationsFromCSV will load operations from CSV.
 func OperationsFromCSV(r io.Reader, analyzeOnly bool, offset, limit int, log func(msg string, v ...interface{})) (Operations, error) {
 	var ops Operations
@@ -1032,6 +1193,8 @@ func OperationsFromCSV(r io.Reader, analyzeOnly bool, offset, limit int, log fun
 	for i, s := range header {
 		fieldIdx[s] = i
 	}
+	// Records are reused, keep the first column name to detect the header of concatenated files.
+	firstCol := header[0]
 	clientMap := make(map[string]string, 16)
 	cb := byte('a')
 	getClient := func(c string) string {
@@ -1069,7 +1232,7 @@ func OperationsFromCSV(r io.Reader, analyzeOnly bool, offset, limit int, log fun
 		if err != nil {
 			return nil, err
 		}
-		if len(values) == 0 {
+		if len(values) == 0 || values[0] == firstCol {
 			continue
 		}
 		if offset > 0 {
@@ -1111,6 +1274,28 @@ func OperationsFromCSV(r io.Reader, analyzeOnly bool, offset, limit int, log fun
 		if idx, ok := fieldIdx["client_id"]; ok {
 			clientID = values[idx]
 		}
+		var due *time.Time
+		if idx, ok := fieldIdx["due"]; ok && values[idx] != "" {
+			t, err := time.Parse(time.RFC3339Nano, values[idx])
+			if err != nil {
+				return nil, err
+			}
+			due = &t
+		}
+		var attempts int
+		if idx, ok := fieldIdx["attempts"]; ok && values[idx] != "" {
+			if attempts, err = strconv.Atoi(values[idx]); err != nil {
+				return nil, err
+			}
+		}
+		var errClass string
+		if idx, ok := fieldIdx["err_class"]; ok {
+			errClass = values[idx]
+		}
+		var channel string
+		if idx, ok := fieldIdx["channel"]; ok {
+			channel = values[idx]
+		}
 		file := fileMap(values[fieldIdx["file"]])
 
 		ops = append(ops, Operation{
@@ -1125,6 +1310,10 @@ func OperationsFromCSV(r io.Reader, analyzeOnly bool, offset, limit int, log fun
 			Thread:    uint16(thread),
 			Endpoint:  endpoint,
 			ClientID:  getClient(clientID),
+			Due:       due,
+			Attempts:  attempts,
+			ErrClass:  errClass,
+			Channel:   channel,
 		})
 		if log != nil && len(ops)%1000000 == 0 {
 			console.Eraseline()
@@ -0,0 +1,189 @@
+/*
+ * Warp (C) 2019-2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bench
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// latencyBuckets are the upper bounds of the latency histogram buckets.
+// Buckets grow by 10% from 100µs, so percentiles are accurate to within 10%.
+var latencyBuckets = func() []time.Duration {
+	var b []time.Duration
+	for d := float64(100 * time.Microsecond); d < float64(24*time.Hour); d *= 1.1 {
+		b = append(b, time.Duration(d))
+	}
+	return b
+}()
+
+// latencyHist is a histogram of operation durations with fixed memory use.
+type latencyHist struct {
+	counts []int64 // one more than latencyBuckets for longer durations
+	n      int64
+	max    time.Duration
+}
+
+func (h *latencyHist) add(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]int64, len(latencyBuckets)+1)
+	}
+	h.counts[sort.Search(len(latencyBuckets), func(i int) bool { return latencyBuckets[i] >= d })]++
+	h.n++
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// percentile returns the upper bound of the bucket containing the p-th percentile (0-100).
+func (h *latencyHist) percentile(p float64) time.Duration {
+	if h.n == 0 {
+		return 0
+	}
+	want := int64(float64(h.n)*p/100 + 0.5)
+	if want < 1 {
+		want = 1
+	}
+	var n int64
+	for i, c := range h.counts {
+		n += c
+		if n >= want {
+			if i < len(latencyBuckets) && latencyBuckets[i] < h.max {
+				return latencyBuckets[i]
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// periodTotals contains the operations of a single type completed in a report period.
+type periodTotals struct {
+	ops, errors, objects, bytes int64
+	hist                        latencyHist
+	// scheduled operations, those of them that missed their deadline and the largest lag.
+	scheduled, missed int64
+	maxLag            time.Duration
+}
+
+func (p *periodTotals) add(op Operation) {
+	p.ops++
+	if op.Err != "" {
+		p.errors++
+	}
+	p.objects += int64(op.ObjPerOp)
+	p.bytes += op.Size
+	p.hist.add(op.Duration())
+	if op.Due != nil {
+		lag := op.Lag()
+		if p.scheduled == 0 || lag > p.maxLag {
+			p.maxLag = lag
+		}
+		p.scheduled++
+		if lag > 0 {
+			p.missed++
+		}
+	}
+}
+
+// PeriodSummary summarizes the operations of a single type completed in a report period.
+type PeriodSummary struct {
+	OpType  string        `json:"type"`
+	Start   time.Time     `json:"start"`
+	End     time.Time     `json:"end"`
+	Ops     int64         `json:"ops"`
+	Errors  int64         `json:"errors"`
+	Objects int64         `json:"objects"`
+	Bytes   int64         `json:"bytes"`
+	P50     time.Duration `json:"p50"`
+	P90     time.Duration `json:"p90"`
+	P99     time.Duration `json:"p99"`
+	Max     time.Duration `json:"max"`
+	// Scheduled is the number of operations with a due time, of which Missed ended after it.
+	Scheduled int64         `json:"scheduled,omitempty"`
+	Missed    int64         `json:"missed,omitempty"`
+	MaxLag    time.Duration `json:"max_lag,omitempty"`
+}
+
+// Throughput returns the average throughput over the period.
+func (p PeriodSummary) Throughput() Throughput {
+	d := p.End.Sub(p.Start)
+	if d <= 0 {
+		return 0
+	}
+	return Throughput(float64(p.Bytes) * float64(time.Second) / float64(d))
+}
+
+// ObjsPerSec returns the average number of objects per second over the period.
+func (p PeriodSummary) ObjsPerSec() float64 {
+	d := p.End.Sub(p.Start)
+	if d <= 0 {
+		return 0
+	}
+	return float64(p.Objects) * float64(time.Second) / float64(d)
+}
+
+func (p PeriodSummary) String() string {
+	s := fmt.Sprintf("%s: %d operations, %d errors, %s, %v, %.2f obj/s. Latency p50 %v, p90 %v, p99 %v, max %v.",
+		p.OpType, p.Ops, p.Errors, humanize.IBytes(uint64(p.Bytes)), p.Throughput(), p.ObjsPerSec(),
+		p.P50.Round(time.Millisecond), p.P90.Round(time.Millisecond), p.P99.Round(time.Millisecond), p.Max.Round(time.Millisecond))
+	if p.Scheduled > 0 {
+		s += fmt.Sprintf(" Schedule lag: %d/%d missed deadline, max lag %v.", p.Missed, p.Scheduled, p.MaxLag.Round(time.Millisecond))
+	}
+	return s
+}
+
+// Rollover ends the current report period at now and starts a new one.
+// It returns a summary for each operation type completed in the period, sorted by operation type.
+// When spilling to chunk files, a new chunk is started, and the chunk files
+// holding the operations of the period are returned, so the period can be analyzed separately.
+func (c *Collector) Rollover(now time.Time) ([]PeriodSummary, []string) {
+	c.opsMu.Lock()
+	defer c.opsMu.Unlock()
+	res := make([]PeriodSummary, 0, len(c.period))
+	for op, p := range c.period {
+		res = append(res, PeriodSummary{
+			OpType:  op,
+			Start:   c.periodStart,
+			End:     now,
+			Ops:     p.ops,
+			Errors:  p.errors,
+			Objects: p.objects,
+			Bytes:   p.bytes,
+			P50:     p.hist.percentile(50),
+			P90:     p.hist.percentile(90),
+			P99:     p.hist.percentile(99),
+			Max:     p.hist.max,
+
+			Scheduled: p.scheduled,
+			Missed:    p.missed,
+			MaxLag:    p.maxLag,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].OpType < res[j].OpType })
+	c.period = make(map[string]*periodTotals)
+	c.periodStart = now
+	var files []string
+	if c.spill != nil {
+		files = c.spill.rotate()
+	}
+	return res, files
+}
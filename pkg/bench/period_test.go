@@ -0,0 +1,76 @@
+/*
+ * Warp (C) 2019-2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bench
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollector_Rollover(t *testing.T) {
+	c := NewSpillCollector(SpillOptions{Prefix: filepath.Join(t.TempDir(), "run")})
+	start := time.Now()
+	var due *time.Time
+	send := func(n int, dur func(i int) time.Duration) {
+		for i := 0; i < n; i++ {
+			c.Receiver() <- Operation{OpType: "PUT", ObjPerOp: 1, Start: start, End: start.Add(dur(i)), Size: 1 << 20, Due: due, Channel: "video0"}
+		}
+	}
+	// Wait for the collector to have received all operations.
+	flush := func(want int64) {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if tot := c.Totals(); len(tot) == 1 && tot[0].Ops == want {
+				return
+			}
+		}
+		t.Fatalf("collector did not receive %d operations", want)
+	}
+
+	send(100, func(i int) time.Duration { return time.Duration(i+1) * time.Millisecond })
+	flush(100)
+	sums, files := c.Rollover(start.Add(time.Minute))
+	if len(sums) != 1 || sums[0].Ops != 100 || len(files) != 1 {
+		t.Fatalf("unexpected first period %+v, files %v", sums, files)
+	}
+	s := sums[0]
+	if s.P50 < 45*time.Millisecond || s.P50 > 56*time.Millisecond || s.P99 < 94*time.Millisecond || s.Max != 100*time.Millisecond {
+		t.Errorf("unexpected percentiles %v", s)
+	}
+	t.Log(s)
+
+	// The operations of the second period miss their deadline.
+	d := start.Add(500 * time.Millisecond)
+	due = &d
+	send(10, func(int) time.Duration { return time.Second })
+	flush(110)
+	c.Close()
+	sums, files = c.Rollover(start.Add(2 * time.Minute))
+	if len(sums) != 1 || sums[0].Ops != 10 || sums[0].P50 != time.Second || len(files) != 1 {
+		t.Fatalf("unexpected second period %+v, files %v", sums, files)
+	}
+	if sums[0].Scheduled != 10 || sums[0].Missed != 10 || sums[0].MaxLag != 500*time.Millisecond {
+		t.Errorf("unexpected schedule lag %v", sums[0])
+	}
+	if lag := c.LagSummaryByOp(); len(lag) != 1 || lag[0].Ops != 10 || lag[0].Missed != 10 || len(lag[0].Threads) != 1 {
+		t.Errorf("unexpected running lag %+v", lag)
+	}
+	if all, _ := c.Spilled(); len(all) != 2 {
+		t.Errorf("want 2 chunk files, got %v", all)
+	}
+}
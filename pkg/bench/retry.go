@@ -0,0 +1,351 @@
+/*
+ * Warp (C) 2019-2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Error classes of errors that are not S3 error responses.
+// S3 error responses are classified by their error code, e.g. SlowDown,
+// or by their HTTP status code if the response has no error code.
+const (
+	ErrClassTimeout     = "timeout"
+	ErrClassCanceled    = "canceled"
+	ErrClassConnReset   = "conn-reset"
+	ErrClassConnRefused = "conn-refused"
+	ErrClassDNS         = "dns"
+	ErrClassEOF         = "eof"
+	ErrClassNetwork     = "network"
+	ErrClassOther       = "other"
+)
+
+// ClassifyError returns the class of an error returned by an S3 request.
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+	var resp minio.ErrorResponse
+	if errors.As(err, &resp) {
+		if resp.Code != "" {
+			return resp.Code
+		}
+		if resp.StatusCode != 0 {
+			return strconv.Itoa(resp.StatusCode)
+		}
+	}
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrClassTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrClassCanceled
+	case errors.As(err, &dnsErr):
+		return ErrClassDNS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrClassTimeout
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ErrClassConnReset
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrClassConnRefused
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return ErrClassEOF
+	case errors.As(err, &opErr):
+		return ErrClassNetwork
+	}
+	return ErrClassOther
+}
+
+// errStatus returns the HTTP status code of an S3 error response, or 0.
+func errStatus(err error) int {
+	var resp minio.ErrorResponse
+	if errors.As(err, &resp) {
+		return resp.StatusCode
+	}
+	return 0
+}
+
+// SetErr records a failed operation with the class of the error.
+func (o *Operation) SetErr(err error) {
+	o.Err = err.Error()
+	o.ErrClass = ClassifyError(err)
+}
+
+// DefaultRetryOn are the error classes and HTTP status codes retried by default.
+var DefaultRetryOn = []string{"SlowDown", "ServiceUnavailable", "RequestTimeout", "InternalError", "503", "500", ErrClassTimeout, ErrClassConnReset, ErrClassEOF}
+
+// RetryPolicy controls retrying failed requests of an operation type.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	// 0 or 1 disables retrying.
+	MaxAttempts int
+	// Backoff is the delay before the first retry. It doubles for each following retry.
+	Backoff time.Duration
+	// MaxBackoff limits the delay between retries, if set.
+	MaxBackoff time.Duration
+	// RetryOn contains the error classes, such as SlowDown or timeout, and HTTP status codes, such as 503, to retry.
+	RetryOn []string
+}
+
+// Retryable returns whether err should be retried.
+func (p RetryPolicy) Retryable(err error) bool {
+	class, status := ClassifyError(err), strconv.Itoa(errStatus(err))
+	for _, on := range p.RetryOn {
+		if strings.EqualFold(on, class) || on == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay returns the delay before the given retry, starting at 1.
+// Half the delay is random, so clients do not retry in lockstep.
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// Do calls fn until it succeeds, returns an error that is not retryable or the attempts are exhausted.
+// Retrying stops when ctx is done. It returns the number of attempts, the final error
+// and the error of the last failed attempt, which is set even if a retry succeeded.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) (attempts int, err, last error) {
+	for {
+		attempts++
+		err = fn()
+		if err != nil {
+			last = err
+		}
+		if err == nil || attempts >= p.MaxAttempts || !p.Retryable(err) {
+			return attempts, err, last
+		}
+		t := time.NewTimer(p.Delay(attempts))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return attempts, err, last
+		case <-t.C:
+		}
+	}
+}
+
+// Record records the result of an operation run with Do.
+// The error class of the last failed attempt is kept when a retry succeeded,
+// so transient errors can be told apart from failures.
+func (o *Operation) Record(attempts int, err, last error) {
+	o.Attempts = attempts
+	if err != nil {
+		o.SetErr(err)
+		return
+	}
+	o.ErrClass = ClassifyError(last)
+}
+
+// ParseRetryPolicies parses per operation type policies, such as "PUT:max=5,backoff=200ms,max-backoff=5s,on=SlowDown|503|timeout".
+// Values not given are taken from def.
+func ParseRetryPolicies(def RetryPolicy, specs []string) (map[string]RetryPolicy, error) {
+	res := make(map[string]RetryPolicy, len(specs))
+	for _, spec := range specs {
+		op, params, _ := strings.Cut(spec, ":")
+		op = strings.ToUpper(strings.TrimSpace(op))
+		if op == "" {
+			return nil, fmt.Errorf("retry policy %q: missing operation type", spec)
+		}
+		p := def
+		for _, kv := range strings.Split(params, ",") {
+			if strings.TrimSpace(kv) == "" {
+				continue
+			}
+			k, v, _ := strings.Cut(kv, "=")
+			var err error
+			switch strings.TrimSpace(k) {
+			case "max":
+				p.MaxAttempts, err = strconv.Atoi(v)
+			case "backoff":
+				p.Backoff, err = time.ParseDuration(v)
+			case "max-backoff":
+				p.MaxBackoff, err = time.ParseDuration(v)
+			case "on":
+				p.RetryOn = strings.Split(v, "|")
+			default:
+				err = errors.New("unknown parameter")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("retry policy %q: %s: %w", spec, k, err)
+			}
+		}
+		res[op] = p
+	}
+	return res, nil
+}
+
+// ErrClassCount is the number of operations with an error class.
+type ErrClassCount struct {
+	Class string `json:"class"`
+	Ops   int    `json:"ops"`
+}
+
+// RetrySummary separates transient errors, that succeeded when retried, from failures.
+type RetrySummary struct {
+	OpType string `json:"op_type"`
+	Ops    int    `json:"ops"`
+	// Attempts is the total number of attempts of all operations.
+	Attempts int `json:"attempts"`
+	// Retried is the number of operations with more than one attempt.
+	Retried int `json:"retried"`
+	// Transient contains the operations that succeeded after a failed attempt, by class of the last error.
+	Transient []ErrClassCount `json:"transient"`
+	// Failed contains the operations that failed, by error class.
+	Failed []ErrClassCount `json:"failed"`
+}
+
+// retryTotals contains running totals of the retries and errors of a single operation type.
+type retryTotals struct {
+	ops, attempts, retried int
+	transient, failed      map[string]int
+}
+
+func (r *retryTotals) add(op Operation) {
+	if r.transient == nil {
+		r.transient, r.failed = make(map[string]int), make(map[string]int)
+	}
+	r.ops++
+	attempts := op.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	r.attempts += attempts
+	if attempts > 1 {
+		r.retried++
+	}
+	switch {
+	case op.Err != "":
+		class := op.ErrClass
+		if class == "" {
+			class = ErrClassOther
+		}
+		r.failed[class]++
+	case op.ErrClass != "":
+		r.transient[op.ErrClass]++
+	}
+}
+
+// summary returns the summary of the operations added so far,
+// or false if none of them had errors or retries.
+func (r *retryTotals) summary(opType string) (RetrySummary, bool) {
+	if r.retried == 0 && len(r.failed) == 0 && len(r.transient) == 0 {
+		return RetrySummary{}, false
+	}
+	return RetrySummary{
+		OpType:    opType,
+		Ops:       r.ops,
+		Attempts:  r.attempts,
+		Retried:   r.retried,
+		Transient: sortClasses(r.transient),
+		Failed:    sortClasses(r.failed),
+	}, true
+}
+
+// RetrySummaryByOp returns the retries and errors of each operation type with errors or retries.
+func (o Operations) RetrySummaryByOp() []RetrySummary {
+	var res []RetrySummary
+	for _, typ := range o.OpTypes() {
+		var r retryTotals
+		for _, op := range o {
+			if op.OpType == typ {
+				r.add(op)
+			}
+		}
+		if s, ok := r.summary(typ); ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// RetrySummaryByOp returns the retries and errors of each operation type received so far
+// with errors or retries, including operations that are only kept in chunk files.
+func (c *Collector) RetrySummaryByOp() []RetrySummary {
+	c.opsMu.Lock()
+	defer c.opsMu.Unlock()
+	var res []RetrySummary
+	for typ, r := range c.retries {
+		if s, ok := r.summary(typ); ok {
+			res = append(res, s)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].OpType < res[j].OpType })
+	return res
+}
+
+// sortClasses returns the counts, most frequent first.
+func sortClasses(m map[string]int) []ErrClassCount {
+	res := make([]ErrClassCount, 0, len(m))
+	for class, n := range m {
+		res = append(res, ErrClassCount{Class: class, Ops: n})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Ops != res[j].Ops {
+			return res[i].Ops > res[j].Ops
+		}
+		return res[i].Class < res[j].Class
+	})
+	return res
+}
+
+func (s RetrySummary) String() string {
+	var b strings.Builder
+	var transient, failed int
+	for _, c := range s.Transient {
+		transient += c.Ops
+	}
+	for _, c := range s.Failed {
+		failed += c.Ops
+	}
+	fmt.Fprintf(&b, "%s Errors: %d operations, %d attempts, %d retried, %d transient errors recovered, %d failed",
+		s.OpType, s.Ops, s.Attempts, s.Retried, transient, failed)
+	for _, c := range s.Transient {
+		fmt.Fprintf(&b, "\n * Transient %s: %d", c.Class, c.Ops)
+	}
+	for _, c := range s.Failed {
+		fmt.Fprintf(&b, "\n * Failed %s: %d", c.Class, c.Ops)
+	}
+	return b.String()
+}
@@ -0,0 +1,105 @@
+/*
+ * Warp (C) 2019-2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{minio.ErrorResponse{Code: "SlowDown", StatusCode: 503}, "SlowDown"},
+		{fmt.Errorf("put: %w", minio.ErrorResponse{StatusCode: 502}), "502"},
+		{context.DeadlineExceeded, ErrClassTimeout},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, ErrClassConnReset},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, ErrClassConnRefused},
+		{&net.DNSError{Name: "s3.local"}, ErrClassDNS},
+		{errors.New("short upload"), ErrClassOther},
+	}
+	for _, test := range tests {
+		if got := ClassifyError(test.err); got != test.want {
+			t.Errorf("%v: want %s, got %s", test.err, test.want, got)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policies, err := ParseRetryPolicies(RetryPolicy{MaxAttempts: 1, RetryOn: DefaultRetryOn}, []string{"put:max=3,backoff=1ms,max-backoff=2ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := policies["PUT"]
+	if p.MaxAttempts != 3 || p.Backoff != time.Millisecond || len(p.RetryOn) != len(DefaultRetryOn) {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+	if d := p.Delay(10); d > 2*time.Millisecond || d < time.Millisecond {
+		t.Errorf("delay %v outside backoff limits", d)
+	}
+
+	slowDown := minio.ErrorResponse{Code: "SlowDown", StatusCode: 503}
+	denied := minio.ErrorResponse{Code: "AccessDenied", StatusCode: 403}
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	var ops Operations
+	for i, errs := range [][]error{
+		{slowDown, nil},                // transient
+		{slowDown, slowDown, slowDown}, // failed after retries
+		{denied},                       // not retried
+		{nil},
+	} {
+		n := 0
+		op := Operation{OpType: "PUT", ObjPerOp: 1, Start: start.Add(time.Duration(i) * time.Second), End: start.Add(time.Duration(i+1) * time.Second)}
+		op.Record(p.Do(context.Background(), func() error {
+			n++
+			return errs[n-1]
+		}))
+		if n != len(errs) || op.Attempts != n {
+			t.Errorf("case %d: want %d attempts, got %d, recorded %d", i, len(errs), n, op.Attempts)
+		}
+		ops = append(ops, op)
+	}
+
+	var buf bytes.Buffer
+	if err := ops.CSV(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	ops, err = OperationsFromCSV(&buf, false, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := ops.RetrySummaryByOp()
+	if len(s) != 1 || s[0].Ops != 4 || s[0].Attempts != 7 || s[0].Retried != 2 {
+		t.Fatalf("unexpected summary %+v", s)
+	}
+	if len(s[0].Transient) != 1 || s[0].Transient[0].Class != "SlowDown" ||
+		len(s[0].Failed) != 2 || s[0].Failed[0].Class != "AccessDenied" || s[0].Failed[1].Class != "SlowDown" {
+		t.Errorf("unexpected error classes %+v", s[0])
+	}
+	t.Log(s[0].String())
+}
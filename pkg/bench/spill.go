@@ -0,0 +1,252 @@
+/*
+ * Warp (C) 2019-2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bench
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/klauspost/compress/zstd"
+)
+
+// SpillOptions controls writing operations to chunk files while they are collected.
+type SpillOptions struct {
+	// Prefix of the chunk files. Chunks are named Prefix-00001.csv.zst, Prefix-00002.csv.zst, etc.
+	Prefix string
+	// ChunkOps is the maximum number of operations in a chunk.
+	ChunkOps int
+	// ChunkDur is the maximum time a chunk is written to before a new one is started.
+	ChunkDur time.Duration
+	// Keep is the number of most recent operations kept in memory.
+	Keep int
+	// Comment is written at the end of every chunk.
+	Comment string
+}
+
+const (
+	defaultSpillChunkOps = 1000000
+	defaultSpillKeep     = 10000
+	// spillFlushInterval is the interval at which written operations are flushed to the chunk file.
+	spillFlushInterval = 10 * time.Second
+)
+
+// ChunkName returns the file name of chunk n.
+func (o SpillOptions) ChunkName(n int) string {
+	return fmt.Sprintf("%s-%05d.csv.zst", o.Prefix, n)
+}
+
+// ChunkFiles returns the chunk files written with the prefix, in the order they were written.
+func ChunkFiles(prefix string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Clean(prefix) + "-[0-9][0-9][0-9][0-9][0-9].csv.zst")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// NewSpillCollector returns a collector that writes operations to rotating
+// zstd compressed CSV chunk files as they are received.
+// Only running totals and the most recent operations are kept in memory.
+func NewSpillCollector(opts SpillOptions) *Collector {
+	if opts.ChunkOps <= 0 {
+		opts.ChunkOps = defaultSpillChunkOps
+	}
+	if opts.Keep <= 0 {
+		opts.Keep = defaultSpillKeep
+	}
+	return newCollector(&spillWriter{opts: opts})
+}
+
+// Spilled returns the chunk files written so far and the first error writing them, if any.
+func (c *Collector) Spilled() ([]string, error) {
+	if c.spill == nil {
+		return nil, nil
+	}
+	c.opsMu.Lock()
+	defer c.opsMu.Unlock()
+	return append([]string(nil), c.spill.files...), c.spill.err
+}
+
+// spillWriter writes operations to rotating chunk files.
+// It is protected by the collector opsMu.
+type spillWriter struct {
+	opts SpillOptions
+
+	f       *os.File
+	enc     *zstd.Encoder
+	bw      *bufio.Writer
+	idx     int // index of the next operation, continued across chunks
+	inChunk int
+	opened  time.Time
+	flushed time.Time
+
+	files      []string
+	periodFrom int // index of the first file of the current report period
+	err        error
+}
+
+func (s *spillWriter) setErr(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *spillWriter) write(op Operation) {
+	now := time.Now()
+	if s.f != nil && (s.inChunk >= s.opts.ChunkOps || (s.opts.ChunkDur > 0 && now.Sub(s.opened) >= s.opts.ChunkDur)) {
+		s.closeChunk()
+	}
+	if s.f == nil {
+		if err := s.openChunk(now); err != nil {
+			s.setErr(err)
+			return
+		}
+	}
+	if err := op.writeCSV(s.bw, s.idx); err != nil {
+		s.setErr(err)
+	}
+	s.idx++
+	s.inChunk++
+	if now.Sub(s.flushed) >= spillFlushInterval {
+		// Limit the operations lost if the process is killed.
+		s.flushed = now
+		err := s.bw.Flush()
+		if err == nil {
+			err = s.enc.Flush()
+		}
+		if err != nil {
+			s.setErr(err)
+		}
+	}
+}
+
+func (s *spillWriter) openChunk(now time.Time) error {
+	name := s.opts.ChunkName(len(s.files) + 1)
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	enc, err := zstd.NewWriter(f, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.enc, s.bw = f, enc, bufio.NewWriter(enc)
+	s.inChunk = 0
+	s.opened, s.flushed = now, now
+	s.files = append(s.files, name)
+	_, err = s.bw.WriteString(csvHeader)
+	return err
+}
+
+func (s *spillWriter) closeChunk() {
+	err := writeCSVComment(s.bw, s.opts.Comment)
+	if err == nil {
+		err = s.bw.Flush()
+	}
+	if err2 := s.enc.Close(); err == nil {
+		err = err2
+	}
+	if err2 := s.f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		s.setErr(err)
+	}
+	s.f, s.enc, s.bw = nil, nil, nil
+}
+
+func (s *spillWriter) close() {
+	if s.f != nil {
+		s.closeChunk()
+	}
+}
+
+// rotate closes the current chunk and returns the chunk files written since the last rotation.
+func (s *spillWriter) rotate() []string {
+	s.close()
+	files := append([]string(nil), s.files[s.periodFrom:]...)
+	s.periodFrom = len(s.files)
+	return files
+}
+
+// OpTotals contains running totals of a single operation type.
+type OpTotals struct {
+	OpType   string        `json:"type"`
+	Ops      int64         `json:"ops"`
+	Errors   int64         `json:"errors"`
+	Objects  int64         `json:"objects"`
+	Bytes    int64         `json:"bytes"`
+	TotalDur time.Duration `json:"total_duration"`
+	MinDur   time.Duration `json:"min_duration"`
+	MaxDur   time.Duration `json:"max_duration"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+}
+
+func (t *OpTotals) add(op Operation) {
+	d := op.Duration()
+	if t.Ops == 0 || d < t.MinDur {
+		t.MinDur = d
+	}
+	if d > t.MaxDur {
+		t.MaxDur = d
+	}
+	if t.Ops == 0 || op.Start.Before(t.Start) {
+		t.Start = op.Start
+	}
+	if op.End.After(t.End) {
+		t.End = op.End
+	}
+	t.Ops++
+	if op.Err != "" {
+		t.Errors++
+	}
+	t.Objects += int64(op.ObjPerOp)
+	t.Bytes += op.Size
+	t.TotalDur += d
+}
+
+// AvgDur returns the average duration of the operations.
+func (t OpTotals) AvgDur() time.Duration {
+	if t.Ops == 0 {
+		return 0
+	}
+	return t.TotalDur / time.Duration(t.Ops)
+}
+
+// Throughput returns the average throughput between the first start and the last end.
+func (t OpTotals) Throughput() Throughput {
+	d := t.End.Sub(t.Start)
+	if d <= 0 {
+		return 0
+	}
+	return Throughput(float64(t.Bytes) * float64(time.Second) / float64(d))
+}
+
+func (t OpTotals) String() string {
+	return fmt.Sprintf("%s: %d operations, %d errors, %s, %v. Duration avg %v, min %v, max %v.",
+		t.OpType, t.Ops, t.Errors, humanize.IBytes(uint64(t.Bytes)), t.Throughput(),
+		t.AvgDur().Round(time.Millisecond), t.MinDur.Round(time.Millisecond), t.MaxDur.Round(time.Millisecond))
+}
@@ -0,0 +1,80 @@
+/*
+ * Warp (C) 2019-2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bench
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpillCollector(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "run")
+	c := NewSpillCollector(SpillOptions{Prefix: prefix, ChunkOps: 3, Keep: 2, Comment: "test"})
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	rcv := c.Receiver()
+	for i := 0; i < 7; i++ {
+		s := start.Add(time.Duration(i) * time.Second)
+		op := Operation{OpType: "PUT", ObjPerOp: 1, Start: s, End: s.Add(time.Second), Size: 100, File: "obj"}
+		if i == 6 {
+			op.OpType, op.Size, op.Err = "DELETE", 0, "failed"
+		}
+		rcv <- op
+	}
+	ops := c.Close()
+	if len(ops) > 4 {
+		t.Errorf("want at most 4 operations kept, got %d", len(ops))
+	}
+
+	totals := c.Totals()
+	if len(totals) != 2 || totals[1].OpType != "PUT" || totals[1].Ops != 6 || totals[1].Bytes != 600 || totals[0].Errors != 1 {
+		t.Errorf("unexpected totals %+v", totals)
+	}
+	written, err := c.Spilled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := ChunkFiles(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 || len(written) != 3 || files[2] != written[2] {
+		t.Fatalf("want 3 chunks, got %v, written %v", files, written)
+	}
+
+	// The chunks read back as a single run.
+	var readers []io.Reader
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	zstdDec.Reset(io.MultiReader(readers...))
+	all, err := OperationsFromCSV(zstdDec, false, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 7 || all[6].OpType != "DELETE" || !all[3].Start.Equal(start.Add(3*time.Second)) {
+		t.Errorf("unexpected operations read back: %+v", all)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Warp (C) 2019-2020 MinIO, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package generator
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// WithFiles will use the content of the files as object data.
+// Objects are returned in rotating order of the files.
+func WithFiles(paths ...string) FileOpts {
+	return FileOpts{paths: paths}
+}
+
+// Apply file data options.
+// The files are opened once and shared read-only by all sources.
+// Object data is streamed from the files, so they are never held in memory.
+func (o FileOpts) Apply() Option {
+	return func(opts *Options) error {
+		if len(o.paths) == 0 {
+			return errors.New("files: no files given")
+		}
+		files := make([]fileData, 0, len(o.paths))
+		for _, p := range o.paths {
+			st, err := os.Stat(p)
+			if err != nil {
+				return err
+			}
+			if st.IsDir() || st.Size() == 0 {
+				continue
+			}
+			f, err := openFileData(p, st.Size())
+			if err != nil {
+				return err
+			}
+			files = append(files, f)
+		}
+		if len(files) == 0 {
+			return errors.New("files: no non-empty files found")
+		}
+		o.files = files
+		opts.files = o
+		opts.src = newFileSrc
+		return nil
+	}
+}
+
+// openFileData opens the file at p and calculates its MD5 by streaming it once.
+// The file is kept open for the lifetime of the process.
+func openFileData(p string, size int64) (fileData, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return fileData{}, err
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, size)); err != nil {
+		f.Close()
+		return fileData{}, err
+	}
+	return fileData{
+		name:        filepath.Base(p),
+		file:        f,
+		size:        size,
+		md5:         hex.EncodeToString(h.Sum(nil)),
+		contentType: mime.TypeByExtension(filepath.Ext(p)),
+	}, nil
+}
+
+// FileOpts are the options for the file data source.
+type FileOpts struct {
+	paths []string
+	files []fileData
+}
+
+type fileData struct {
+	name string
+	// file is only read with ReadAt, which is safe for concurrent use.
+	file        *os.File
+	size        int64
+	md5         string
+	contentType string
+}
+
+// fileSrcCounter makes sources start at different files.
+var fileSrcCounter uint64
+
+type fileSrc struct {
+	o       Options
+	counter uint64
+	obj     Object
+}
+
+func newFileSrc(o Options) (Source, error) {
+	r := fileSrc{
+		o:       o,
+		counter: atomic.AddUint64(&fileSrcCounter, 1) - 1,
+	}
+	r.obj.setPrefix(o)
+	return &r, nil
+}
+
+func (r *fileSrc) Object() *Object {
+	f := r.o.files.files[r.counter%uint64(len(r.o.files.files))]
+	r.counter++
+	r.obj.Size = f.size
+	r.obj.Md5 = f.md5
+	r.obj.ContentType = f.contentType
+	if r.obj.ContentType == "" {
+		r.obj.ContentType = "application/octet-stream"
+	}
+	r.obj.setName(fmt.Sprintf("%d.%s", r.counter, f.name))
+	r.obj.Reader = io.NewSectionReader(f.file, 0, f.size)
+	return &r.obj
+}
+
+func (r *fileSrc) String() string {
+	return fmt.Sprintf("File data; %d files", len(r.o.files.files))
+}
+
+func (r *fileSrc) Prefix() string {
+	return r.obj.Prefix
+}
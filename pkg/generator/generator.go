@@ -60,6 +60,9 @@ type Object struct {
 	Prefix string
 
 	VersionID string
+
+	// Md5 is the hex encoded MD5 of the content, if known in advance.
+	Md5 string
 }
 
 // Objects is a slice of objects.
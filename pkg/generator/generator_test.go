@@ -18,8 +18,12 @@
 package generator
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -225,3 +229,42 @@ func BenchmarkWithRandomData(b *testing.B) {
 		})
 	}
 }
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	contents := []string{"first video file", "second, longer video file"}
+	var paths []string
+	for i, c := range contents {
+		p := filepath.Join(dir, string(rune('a'+i))+".mp4")
+		if err := os.WriteFile(p, []byte(c), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+	// Directories are skipped.
+	paths = append(paths, dir)
+
+	src, err := New(WithFiles(paths...).Apply())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*len(contents); i++ {
+		obj := src.Object()
+		b, err := io.ReadAll(obj.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := contents[i%len(contents)]
+		if string(b) != want || obj.Size != int64(len(want)) {
+			t.Fatalf("object %d: got %q (size %d), want %q", i, b, obj.Size, want)
+		}
+		sum := md5.Sum(b)
+		if obj.Md5 != hex.EncodeToString(sum[:]) {
+			t.Errorf("object %d: md5 %s does not match content", i, obj.Md5)
+		}
+	}
+
+	if _, err := New(WithFiles(dir).Apply()); err == nil {
+		t.Error("want error without files")
+	}
+}
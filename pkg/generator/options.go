@@ -32,6 +32,7 @@ type Options struct {
 	customPrefix string
 	csv          CsvOpts
 	random       RandomOpts
+	files        FileOpts
 	randomPrefix int
 }
 
@@ -0,0 +1,164 @@
+package workflow
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"stress/api"
+	"stress/pkg/aggregate"
+	"stress/pkg/bench"
+	. "stress/pkg/logger"
+)
+
+// periodReporter writes a summary of every report period of a run without end time,
+// so the state of a long-term run can be followed and every period analyzed separately.
+type periodReporter struct {
+	b        Workflow
+	monitor  *api.Server
+	fileName string
+	interval time.Duration
+	n        int
+	// drift compares the periods to the first periods of the run, if enabled.
+	drift *aggregate.DriftDetector
+}
+
+// runPeriodReports writes a summary to fileName-periods.csv and the log at every multiple of interval,
+// until ctx is done. If drift.Window is set, every period is also compared to a baseline at the start of the run.
+// The returned function must be called after the workflow has stopped;
+// it waits for the reporter, writes the summary of the last, partial period and returns whether the drift check passed.
+func runPeriodReports(ctx context.Context, b Workflow, monitor *api.Server, fileName string, interval time.Duration, drift aggregate.DriftOptions) (wait func() bool) {
+	r := &periodReporter{b: b, monitor: monitor, fileName: fileName + "-periods.csv", interval: interval}
+	if drift.Window > 0 {
+		r.drift = aggregate.NewDriftDetector(drift)
+	}
+	monitor.InfoLn(fmt.Sprintf("Writing a summary every %v to %q", interval, r.fileName))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			// Periods end at multiples of the interval, e.g. every full hour.
+			now := time.Now()
+			t := time.NewTimer(now.Truncate(interval).Add(interval).Sub(now))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case now = <-t.C:
+			}
+			r.report(now)
+		}
+	}()
+	return func() bool {
+		<-done
+		r.report(time.Now())
+		return r.driftVerdict(fileName + "-drift.json")
+	}
+}
+
+// report ends the current period and writes its summary.
+func (r *periodReporter) report(now time.Time) {
+	col := r.b.GetCommon().collector.get()
+	if col == nil {
+		return
+	}
+	sums, files := col.Rollover(now)
+	r.n++
+	var status string
+	if ps, ok := r.b.(PeriodStatuser); ok {
+		status = ps.PeriodStatus()
+	}
+
+	lines := []string{fmt.Sprintf("Period %d ending %s:", r.n, now.Format(time.RFC3339))}
+	if len(sums) == 0 {
+		lines = append(lines, "No operations completed.")
+	}
+	for _, s := range sums {
+		lines = append(lines, s.String())
+		// Short periods, such as the first one before an interval boundary, are not compared.
+		if r.drift != nil && s.End.Sub(s.Start) >= r.interval/2 {
+			if w := r.drift.Add(s.OpType, aggregate.DriftWindowFromPeriod(s)); len(w.Offending) > 0 {
+				lines = append(lines, fmt.Sprintf("DEGRADED %s: %s", s.OpType, strings.Join(w.Offending, ", ")))
+			}
+		}
+	}
+	if status != "" {
+		lines = append(lines, status)
+	}
+	if len(files) > 0 {
+		lines = append(lines, "Operations: "+strings.Join(files, " "))
+	}
+	for _, l := range lines {
+		r.monitor.InfoLn(l)
+		Logger.Info(l)
+	}
+	if err := r.write(sums, status, files); err != nil {
+		r.monitor.Errorln("Unable to write period summary:", err)
+	}
+}
+
+// write appends the period summary to the report file.
+func (r *periodReporter) write(sums []bench.PeriodSummary, status string, files []string) error {
+	_, err := os.Stat(r.fileName)
+	header := os.IsNotExist(err)
+	f, err := os.OpenFile(r.fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if header {
+		w.Write([]string{"period", "start", "end", "op", "ops", "errors", "objects", "bytes", "bytes_per_sec", "obj_per_sec",
+			"p50_ns", "p90_ns", "p99_ns", "max_ns", "scheduled", "missed", "max_lag_ns", "status", "chunks"})
+	}
+	for _, s := range sums {
+		w.Write([]string{
+			strconv.Itoa(r.n),
+			s.Start.Format(time.RFC3339Nano),
+			s.End.Format(time.RFC3339Nano),
+			s.OpType,
+			strconv.FormatInt(s.Ops, 10),
+			strconv.FormatInt(s.Errors, 10),
+			strconv.FormatInt(s.Objects, 10),
+			strconv.FormatInt(s.Bytes, 10),
+			strconv.FormatFloat(float64(s.Throughput()), 'f', 1, 64),
+			strconv.FormatFloat(s.ObjsPerSec(), 'f', 3, 64),
+			strconv.FormatInt(int64(s.P50), 10),
+			strconv.FormatInt(int64(s.P90), 10),
+			strconv.FormatInt(int64(s.P99), 10),
+			strconv.FormatInt(int64(s.Max), 10),
+			strconv.FormatInt(s.Scheduled, 10),
+			strconv.FormatInt(s.Missed, 10),
+			strconv.FormatInt(int64(s.MaxLag), 10),
+			status,
+			strings.Join(files, " "),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// driftVerdict logs the drift analysis of the periods, writes it to fileName and returns whether it passed.
+func (r *periodReporter) driftVerdict(fileName string) bool {
+	if r.drift == nil {
+		return true
+	}
+	rep := r.drift.Report()
+	for _, l := range strings.Split(rep.String(), "\n") {
+		r.monitor.InfoLn(l)
+		Logger.Info(l)
+	}
+	b, err := json.MarshalIndent(rep, "", "  ")
+	if err == nil {
+		err = os.WriteFile(fileName, b, 0o644)
+	}
+	if err != nil {
+		r.monitor.Errorln("Unable to write drift report:", err)
+	}
+	return rep.Pass
+}
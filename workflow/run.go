@@ -8,13 +8,16 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"stress/api"
 	client "stress/client/s3"
 	"stress/config"
+	"stress/pkg/aggregate"
 	"stress/pkg/bench"
 	. "stress/pkg/logger"
 	"stress/pkg/printer"
@@ -67,66 +70,145 @@ func RunWorkflow(ctx *cli.Context, b Workflow) error {
 	serverFlagName := "serve"
 	monitor := api.NewBenchmarkMonitor(ctx.String(serverFlagName))
 	monitor.SetLnLoggers(printer.PrintInfo, printer.PrintError)
+	monitor.SetInFlight(&client.Requests)
 	defer monitor.Done()
 
+	// The first SIGINT/SIGTERM stops starting new operations, a second one exits at once.
+	root, stopTrap := trapInterrupts(monitor)
+	defer stopTrap()
+	drain := ctx.Duration("shutdown.timeout")
+
 	monitor.InfoLn("Preparing server.")
-	pgDone := make(chan struct{})
 	c := b.GetCommon()
+	c.abort, c.abortRequests = context.WithCancel(context.Background())
+	c.collector = &collectorRef{}
+	defer c.abortRequests()
+	// Live metrics of the monitor are updated by every collector.
+	c.Observers = append(c.Observers, monitor)
 	c.Clear = !ctx.Bool("noclear")
 	if ctx.Bool("autoterm") {
 		// TODO: autoterm cannot be used when in client/server mode
 		c.AutoTermDur = ctx.Duration("autoterm.dur")
 		c.AutoTermScale = ctx.Float64("autoterm.pct") / 100
 	}
-	if !config.GlobalQuiet && !config.GlobalJSON {
-		c.PrepareProgress = make(chan float64, 1)
-		const pgScale = 10000
-		pg := utils.NewProgressBar(pgScale, pb.U_NO)
-		pg.ShowCounters = false
-		pg.ShowElapsedTime = false
-		pg.ShowSpeed = false
-		pg.ShowTimeLeft = false
-		pg.ShowFinalTime = true
-		go func() {
-			defer close(pgDone)
-			defer pg.Finish()
-			tick := time.NewTicker(time.Millisecond * 125)
-			defer tick.Stop()
-			pg.Set(-1)
-			pg.SetCaption("Preparing: ")
-			newVal := int64(-1)
-			for {
-				select {
-				case <-tick.C:
-					current := pg.Get()
-					if current != newVal {
-						pg.Set64(newVal)
-						pg.Update()
-					}
-					monitor.InfoQuietln(fmt.Sprintf("Preparation: %0.0f%% done...", float64(newVal)/float64(100)))
-				case pct, ok := <-c.PrepareProgress:
-					if !ok {
-						pg.Set64(pgScale)
-						if newVal > 0 {
-							pg.Update()
-						}
-						return
-					}
-					newVal = int64(pct * pgScale)
-				}
-			}
-		}()
-	} else {
-		close(pgDone)
+	pgDone := showPrepareProgress(c, monitor, "Preparing: ")
+	err := b.Prepare(root)
+	if root.Err() == nil {
+		printer.FatalIf(probe.NewError(err), "Error preparing server")
 	}
-
-	err := b.Prepare(context.Background())
-	printer.FatalIf(probe.NewError(err), "Error preparing server")
 	if c.PrepareProgress != nil {
 		close(c.PrepareProgress)
 		<-pgDone
 	}
 
+	fileName := ctx.String("benchdata")
+	cID := pRandASCII(4)
+	if fileName == "" {
+		fileName = fmt.Sprintf("%s-%s-%s-%s", config.AppName, ctx.Command.Name, time.Now().Format("2006-01-02[150405]"), cID)
+	}
+
+	// aborted is set when operations in progress did not finish within the drain timeout after an interrupt.
+	var aborted bool
+	if pf, ok := b.(Prefiller); ok && root.Err() == nil {
+		c.Spill = spillOptions(ctx, fileName+"-prefill", ctx.Bool("spill"))
+		monitor.InfoLn("Prefilling data...")
+		pgDone := showPrepareProgress(c, monitor, "Prefilling: ")
+		ops, drained, err := collect(root, c, monitor, drain, func() (bench.Operations, error) {
+			return pf.Prefill(root)
+		})
+		aborted = !drained
+		if c.PrepareProgress != nil {
+			close(c.PrepareProgress)
+			<-pgDone
+		}
+		printer.FatalIf(probe.NewError(err), "Error prefilling data")
+		ops.SortByStartTime()
+		ops.SetClientID(cID)
+		saveResults(ctx, monitor, c, ops, fileName+"-prefill")
+		// The prefill results are saved, the main run uses its own spill options and collector.
+		c.Spill = nil
+		c.collector.set(nil)
+	}
+
+	var ops bench.Operations
+	pass := true
+	// ran is set when the main run was started, i.e. not interrupted during Prepare or Prefill.
+	ran := root.Err() == nil
+	if ran {
+		var drained bool
+		ops, pass, drained = runMain(ctx, root, b, monitor, fileName)
+		aborted = aborted || !drained
+
+		// Previous context is canceled, create a new...
+		monitor.InfoLn("Saving benchmark data...")
+		ops.SortByStartTime()
+		ops.SetClientID(cID)
+
+		lags, retries := ops.LagSummaryByOp(), ops.RetrySummaryByOp()
+		if !saveResults(ctx, monitor, c, ops, fileName) {
+			// Only the most recent operations are kept in memory, use the running totals of all operations.
+			col := c.collector.get()
+			lags, retries = col.LagSummaryByOp(), col.RetrySummaryByOp()
+		}
+		for _, lag := range lags {
+			monitor.InfoLn(lag.String(10))
+			Logger.Info(lag.String(10))
+		}
+		for _, r := range retries {
+			monitor.InfoLn(r.String())
+			Logger.Info(r.String())
+		}
+		if r, ok := b.(Reporter); ok {
+			if err := r.Report(fileName); err != nil {
+				monitor.Errorln("Unable to write workflow report:", err)
+			}
+		}
+	} else {
+		monitor.InfoLn("Interrupted before the benchmark started, no benchmark data to save.")
+	}
+	interrupted := root.Err() != nil
+	if s, ok := b.(StateSaver); ok && interrupted {
+		if err := s.SaveState(); err != nil {
+			monitor.Errorln("Unable to save workflow state:", err)
+		}
+	}
+	monitor.OperationsReady(ops, fileName, utils.CommandLine(ctx))
+	// printAnalysis(ctx, ops)
+	if interrupted && !ctx.Bool("shutdown.cleanup") {
+		monitor.InfoLn("Interrupted, skipping cleanup. Use --shutdown.cleanup to clean up after an interrupt.")
+		return errDrift(pass)
+	}
+	if aborted {
+		// Aborted uploads may still be completed by the server, the objects are left for the next run.
+		monitor.InfoLn("Operations in progress were aborted, skipping cleanup.")
+		return errDrift(pass)
+	}
+	if !ctx.Bool("keep-data") && !ctx.Bool("noclear") {
+		monitor.InfoLn("Starting cleanup...")
+		b.Cleanup(context.Background())
+	}
+	monitor.InfoLn("Cleanup Done.")
+	return errDrift(pass)
+}
+
+// errDrift returns an error if the drift check failed, so the process exits with a non-zero status.
+func errDrift(pass bool) error {
+	if pass {
+		return nil
+	}
+	return errors.New("performance degraded during the run")
+}
+
+// runMain runs the main workflow until the duration has passed or root is canceled,
+// and returns the collected operations, whether the drift check passed
+// and whether operations in progress finished in time after an interrupt.
+func runMain(ctx *cli.Context, root context.Context, b Workflow, monitor *api.Server, fileName string) (ops bench.Operations, pass, drained bool) {
+	c := b.GetCommon()
+	// Without end time, operations are always written to chunk files to bound memory use.
+	benchDur := ctx.Duration("duration")
+	forever := benchDur <= 0
+	c.Spill = spillOptions(ctx, fileName, ctx.Bool("spill") || forever)
+
 	// if ap, ok := b.(AfterPreparer); ok {
 	// 	err := ap.AfterPrepare(context.Background())
 	// 	printer.FatalIf(probe.NewError(err), "Error preparing server")
@@ -145,8 +227,14 @@ func RunWorkflow(ctx *cli.Context, b Workflow) error {
 		}
 	}
 
-	benchDur := ctx.Duration("duration")
-	ctx2, cancel := context.WithDeadline(context.Background(), tStart.Add(benchDur))
+	var ctx2 context.Context
+	var cancel context.CancelFunc
+	if forever {
+		// Run until signalled.
+		ctx2, cancel = context.WithCancel(root)
+	} else {
+		ctx2, cancel = context.WithDeadline(root, tStart.Add(benchDur))
+	}
 	defer cancel()
 	start := make(chan struct{})
 	go func() {
@@ -155,17 +243,26 @@ func RunWorkflow(ctx *cli.Context, b Workflow) error {
 		close(start)
 	}()
 
-	fileName := ctx.String("benchdata")
-	cID := pRandASCII(4)
-	if fileName == "" {
-		fileName = fmt.Sprintf("%s-%s-%s-%s", config.AppName, ctx.Command.Name, time.Now().Format("2006-01-02[150405]"), cID)
-	}
-
 	prof, err := startProfiling(ctx2, ctx)
 	printer.FatalIf(probe.NewError(err), "Unable to start profile.")
 	monitor.InfoLn("Starting benchmark in ", time.Until(tStart).Round(time.Second), "...")
-	pgDone = make(chan struct{})
-	if !config.GlobalQuiet && !config.GlobalJSON {
+	if forever {
+		monitor.InfoLn("Running until interrupted...")
+	}
+	waitReports := func() bool { return true }
+	drift := DriftOptions(ctx)
+	interval := ctx.Duration("report.interval")
+	if drift.Window > 0 {
+		// Every report period is a window compared to the baseline.
+		interval = drift.Window
+	}
+	if (forever && interval > 0) || drift.Window > 0 {
+		// Periods are only reported once Start has created its collector, never from the Prefill collector.
+		c.collector.set(nil)
+		waitReports = runPeriodReports(ctx2, b, monitor, fileName, interval, drift)
+	}
+	pgDone := make(chan struct{})
+	if !config.GlobalQuiet && !config.GlobalJSON && !forever {
 		pg := utils.NewProgressBar(int64(benchDur), pb.U_DURATION)
 		go func() {
 			defer close(pgDone)
@@ -194,41 +291,196 @@ func RunWorkflow(ctx *cli.Context, b Workflow) error {
 	} else {
 		close(pgDone)
 	}
-	ops, _ := b.Start(ctx2, start)
+	ops, drained, _ = collect(root, c, monitor, ctx.Duration("shutdown.timeout"), func() (bench.Operations, error) {
+		return b.Start(ctx2, start)
+	})
 	cancel()
 	<-pgDone
+	pass = waitReports()
+	prof.stop(context.Background(), ctx, fileName+".profiles.zip")
+	return ops, pass, drained
+}
 
-	// Previous context is canceled, create a new...
-	monitor.InfoLn("Saving benchmark data...")
-	ctx2 = context.Background()
-	ops.SortByStartTime()
-	ops.SetClientID(cID)
-	prof.stop(ctx2, ctx, fileName+".profiles.zip")
+// trapInterrupts returns a context that is canceled on the first SIGINT or SIGTERM.
+// A second signal exits the process at once, without saving anything.
+func trapInterrupts(monitor *api.Server) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			return
+		case sig := <-sigs:
+			monitor.InfoLn(fmt.Sprintf("Received %v, stopping. Waiting for operations in progress; signal again to exit at once.", sig))
+			Logger.Warnf("Received %v, stopping", sig)
+			cancel()
+		}
+		select {
+		case <-done:
+		case sig := <-sigs:
+			monitor.Errorln(fmt.Sprintf("Received %v again, exiting without saving.", sig))
+			Logger.Errorf("Received %v again, exiting without saving", sig)
+			os.Exit(1)
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel()
+	}
+}
+
+// collect runs fn and returns the operations it collected.
+// If root is canceled, operations in progress are given the timeout to finish.
+// After that requests in progress are aborted, and fn is waited for, so nothing runs after collect returns.
+// drained is false if operations had to be aborted.
+func collect(root context.Context, c *Common, monitor *api.Server, timeout time.Duration, fn func() (bench.Operations, error)) (ops bench.Operations, drained bool, err error) {
+	type result struct {
+		ops bench.Operations
+		err error
+	}
+	res := make(chan result, 1)
+	go func() {
+		ops, err := fn()
+		res <- result{ops: ops, err: err}
+	}()
+	select {
+	case r := <-res:
+		return r.ops, true, r.err
+	case <-root.Done():
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case r := <-res:
+		return r.ops, true, r.err
+	case <-expired:
+	}
+	monitor.Errorln(fmt.Sprintf("Operations in progress did not finish within %v, aborting them.", timeout))
+	c.abortRequests()
+	r := <-res
+	return r.ops, false, r.err
+}
 
+// showPrepareProgress shows a progress bar updated through c.PrepareProgress.
+// The returned channel is closed once c.PrepareProgress has been closed and the bar is finished.
+func showPrepareProgress(c *Common, monitor *api.Server, caption string) chan struct{} {
+	pgDone := make(chan struct{})
+	if config.GlobalQuiet || config.GlobalJSON {
+		c.PrepareProgress = nil
+		close(pgDone)
+		return pgDone
+	}
+	c.PrepareProgress = make(chan float64, 1)
+	const pgScale = 10000
+	pg := utils.NewProgressBar(pgScale, pb.U_NO)
+	pg.ShowCounters = false
+	pg.ShowElapsedTime = false
+	pg.ShowSpeed = false
+	pg.ShowTimeLeft = false
+	pg.ShowFinalTime = true
+	go func() {
+		defer close(pgDone)
+		defer pg.Finish()
+		tick := time.NewTicker(time.Millisecond * 125)
+		defer tick.Stop()
+		pg.Set(-1)
+		pg.SetCaption(caption)
+		newVal := int64(-1)
+		for {
+			select {
+			case <-tick.C:
+				current := pg.Get()
+				if current != newVal {
+					pg.Set64(newVal)
+					pg.Update()
+				}
+				monitor.InfoQuietln(fmt.Sprintf("%s%0.0f%% done...", caption, float64(newVal)/float64(100)))
+			case pct, ok := <-c.PrepareProgress:
+				if !ok {
+					pg.Set64(pgScale)
+					if newVal > 0 {
+						pg.Update()
+					}
+					return
+				}
+				newVal = int64(pct * pgScale)
+			}
+		}
+	}()
+	return pgDone
+}
+
+// saveOperations writes the operations to fileName.csv.zst.
+func saveOperations(ctx *cli.Context, monitor *api.Server, ops bench.Operations, fileName string) {
 	f, err := os.Create(fileName + ".csv.zst")
 	if err != nil {
 		monitor.Errorln("Unable to write benchmark data:", err)
-	} else {
-		func() {
-			defer f.Close()
-			enc, err := zstd.NewWriter(f, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
-			printer.FatalIf(probe.NewError(err), "Unable to compress benchmark output")
+		return
+	}
+	defer f.Close()
+	enc, err := zstd.NewWriter(f, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	printer.FatalIf(probe.NewError(err), "Unable to compress benchmark output")
 
-			defer enc.Close()
-			err = ops.CSV(enc, utils.CommandLine(ctx))
-			printer.FatalIf(probe.NewError(err), "Unable to write benchmark output")
+	defer enc.Close()
+	err = ops.CSV(enc, utils.CommandLine(ctx))
+	printer.FatalIf(probe.NewError(err), "Unable to write benchmark output")
 
-			monitor.InfoLn(fmt.Sprintf("Benchmark data written to %q\n", fileName+".csv.zst"))
-		}()
+	monitor.InfoLn(fmt.Sprintf("Benchmark data written to %q\n", fileName+".csv.zst"))
+}
+
+// spillOptions returns the options for writing operations to chunk files
+// named fileName-00001.csv.zst etc. while they are collected, or nil if disabled.
+func spillOptions(ctx *cli.Context, fileName string, enabled bool) *bench.SpillOptions {
+	if !enabled {
+		return nil
 	}
-	monitor.OperationsReady(ops, fileName, utils.CommandLine(ctx))
-	// printAnalysis(ctx, ops)
-	if !ctx.Bool("keep-data") && !ctx.Bool("noclear") {
-		monitor.InfoLn("Starting cleanup...")
-		b.Cleanup(context.Background())
+	return &bench.SpillOptions{
+		Prefix:   fileName,
+		ChunkOps: ctx.Int("spill.ops"),
+		ChunkDur: ctx.Duration("spill.dur"),
+		Keep:     ctx.Int("spill.keep"),
+		Comment:  utils.CommandLine(ctx),
 	}
-	monitor.InfoLn("Cleanup Done.")
-	return nil
+}
+
+// DriftOptions returns the options of the degradation analysis, with a zero window if disabled.
+func DriftOptions(ctx *cli.Context) aggregate.DriftOptions {
+	return aggregate.DriftOptions{
+		Window:            ctx.Duration("drift"),
+		BaselineWindows:   ctx.Int("drift.baseline"),
+		MaxThroughputDrop: ctx.Float64("drift.throughput") / 100,
+		MaxLatencyRise:    ctx.Float64("drift.latency") / 100,
+		MaxErrorRise:      ctx.Float64("drift.errors") / 100,
+		Sigma:             ctx.Float64("drift.sigma"),
+	}
+}
+
+// saveResults writes the operations to fileName.csv.zst, unless they have already
+// been written to chunk files by the collector. In that case the running totals are printed.
+// Returns whether ops contains all operations.
+func saveResults(ctx *cli.Context, monitor *api.Server, c *Common, ops bench.Operations, fileName string) bool {
+	col := c.collector.get()
+	if c.Spill == nil || col == nil {
+		saveOperations(ctx, monitor, ops, fileName)
+		return true
+	}
+	files, err := col.Spilled()
+	if err != nil {
+		monitor.Errorln("Unable to write benchmark data:", err)
+	}
+	monitor.InfoLn(fmt.Sprintf("Benchmark data written to %d chunks %q\n", len(files), fileName+"-*.csv.zst"))
+	for _, t := range col.Totals() {
+		monitor.InfoLn(t.String())
+		Logger.Info(t.String())
+	}
+	return false
 }
 
 var (
@@ -1,16 +1,23 @@
 package video
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	fileOps "stress/client/fs"
+	"stress/models"
 	. "stress/pkg/logger"
 	"strings"
 
 	"github.com/dustin/go-humanize"
 )
 
+// minPartSize S3 多段上传除最后一个分片外的最小分片大小
+const minPartSize = 5 << 20
+
 // ForeachStruct 遍历并打印结构体
 func foreachStruct(obj interface{}) {
 	max := 14
@@ -40,24 +47,132 @@ func (v *VideoInfo) printVideoInfo() bool {
 	Logger.Infof("%s 自定义变量信息 %s", fmtStr, fmtStr)
 	foreachStruct(v.VideoCustomizeInfo)
 
+	for _, g := range v.Groups {
+		Logger.Infof("%s 视频组 %s %s", fmtStr, g.GroupName, fmtStr)
+		foreachStruct(g.VideoBaseInfo)
+		foreachStruct(g.VideoDataInfo)
+	}
+
 	return true
 }
 
-// 视频监控场景 - 数据模型计算
-func (v *VideoInfo) CalcData() *VideoInfo {
+// 视频监控场景 - 数据模型计算，参数组合无效时返回错误说明
+func (v *VideoInfo) CalcData() error {
 	Logger.Infof("计算分析数据模型/参数...")
-	v.FileInfo = *fileOps.GetFileInfo(v.FileInfo.FullPath)
-	v.FileInfoHuman = fmt.Sprintf("Path=%s; Size=%s", v.FileInfo.FullPath, v.FileInfo.SizeHuman)
+	if v.TotalCapacity == 0 {
+		return errors.New("集群可用空间(capacity)为0: 对象总数、保留期限均按安全水位容量计算，请指定集群可用空间")
+	}
+	if v.SafeWaterLevel <= 0 || v.SafeWaterLevel > 1 {
+		return fmt.Errorf("安全水位(safe-water-level)为 %v: 应在 (0, 1] 之间，例如 0.9 表示 90%%", v.SafeWaterLevel)
+	}
+	if v.Appendable && v.DisableMultipart {
+		return errors.New("追加写(appendable)基于多段上传实现，不能与非多段上传(disable-multipart)同时使用")
+	}
 	v.TotalCapacityHuman = humanize.IBytes(v.TotalCapacity)
 	v.SafeWaterLevelHuman = fmt.Sprintf("%v %%", v.SafeWaterLevel*100)
 	v.SafeWaterCapacity = uint64(float32(v.TotalCapacity) * v.SafeWaterLevel)
 	v.SafeWaterCapacityHuman = humanize.IBytes(v.SafeWaterCapacity)
-	if v.PrepareChannelNum < v.ChannelNum {
-		v.PrepareChannelNum = v.ChannelNum
+
+	if len(v.Groups) > 0 {
+		if err := v.calcGroups(); err != nil {
+			return err
+		}
+	} else {
+		if err := v.loadFileInfo(); err != nil {
+			return err
+		}
+		if err := v.calcModel(); err != nil {
+			return err
+		}
+	}
+
+	// 打印计算结果
+	v.printVideoInfo()
+	return nil
+}
+
+// loadFileInfo 读取源文件信息，场景文件中已指定对象大小时不读取
+func (v *VideoInfo) loadFileInfo() error {
+	if v.FileInfo.Size == 0 {
+		if v.FileInfo.FullPath == "" {
+			return errors.New("未指定源文件(local-path)或对象大小: 无法计算对象数量和产生间隔")
+		}
+		st, err := os.Stat(v.FileInfo.FullPath)
+		if err != nil {
+			return fmt.Errorf("读取源文件(local-path)失败: %w", err)
+		}
+		if st.IsDir() {
+			return v.loadDirInfo()
+		}
+		v.FileInfo = *fileOps.GetFileInfo(v.FileInfo.FullPath)
+	}
+	if v.FileInfo.Size == 0 {
+		return fmt.Errorf("源文件 %s 大小为0: 无法计算对象数量和产生间隔", v.FileInfo.FullPath)
+	}
+	v.FileInfoHuman = fmt.Sprintf("Path=%s; Size=%s", v.FileInfo.FullPath, v.FileInfo.SizeHuman)
+	return nil
+}
+
+// loadDirInfo 源路径为目录时，对象大小取目录下非空文件的平均大小，
+// 与轮流上传这些文件时的平均对象大小一致
+func (v *VideoInfo) loadDirInfo() error {
+	dir := v.FileInfo.FullPath
+	var total uint64
+	var n int
+	for _, f := range fileOps.GetDirFiles(dir) {
+		st, err := os.Stat(f)
+		if err != nil {
+			return fmt.Errorf("读取源文件(local-path)失败: %w", err)
+		}
+		if st.IsDir() || st.Size() == 0 {
+			continue
+		}
+		total += uint64(st.Size())
+		n++
+	}
+	if n == 0 {
+		return fmt.Errorf("源目录 %s 下没有非空文件: 无法计算对象数量和产生间隔", dir)
+	}
+	size := total / uint64(n)
+	v.FileInfo = models.FileInfo{
+		Name:      filepath.Base(dir),
+		FullPath:  dir,
+		Size:      size,
+		SizeHuman: humanize.IBytes(size),
 	}
+	v.FileInfoHuman = fmt.Sprintf("Path=%s; %d files, Total=%s, Mean Size=%s", dir, n, humanize.IBytes(total), v.FileInfo.SizeHuman)
+	return nil
+}
+
+// sizePD 每天数据量 = 平均码流 * 路数 * 1天，单位 byte
+func (v *VideoInfo) sizePD() float32 {
+	return (v.avgBitStream() / 8) * float32(v.ChannelNum) * 60 * 60 * 24 * 1024 * 1024
+}
 
+// calcModel 按安全容量、码流、对象大小计算数据模型
+func (v *VideoInfo) calcModel() error {
+	if v.BitStream <= 0 {
+		return fmt.Errorf("视频码流(bitstream)为 %v Mbps: 应大于0", v.BitStream)
+	}
+	if v.ChannelNum < 0 || v.DataLife < 0 {
+		return fmt.Errorf("视频路数(channel-num) %d、保留期限(datalife) %v 不能为负数", v.ChannelNum, v.DataLife)
+	}
+	if v.ChannelNum == 0 && v.DataLife == 0 {
+		return errors.New("视频路数(channel-num)与保留期限(datalife)不能同时为0: 至少指定其一，另一个按安全水位容量推算")
+	}
+	if v.Appendable && v.Segments < 1 {
+		return fmt.Errorf("追加写分片数(appendable.segments)为 %d: 应大于等于1", v.Segments)
+	}
+	if v.Segments < 1 {
+		v.Segments = 1
+	}
+	if err := v.checkEvents(); err != nil {
+		return err
+	}
+	// 启用事件模型时，数据量、对象数量和产生间隔均按平均码流计算
+	v.AvgBitStream = v.avgBitStream()
 	// 总带宽=码流/8*路数 MB/s
-	v.BandWidth = (v.BitStream / 8) * float32(v.ChannelNum)
+	v.BandWidth = (v.AvgBitStream / 8) * float32(v.ChannelNum)
 
 	// 每天数据量 = 带宽 * 1天
 	var sizePD = v.BandWidth * 60 * 60 * 24 * 1024 * 1024
@@ -67,15 +182,22 @@ func (v *VideoInfo) CalcData() *VideoInfo {
 	}
 	v.DataLifeHuman = fmt.Sprintf("%.3f", v.DataLife)
 
-	// 每天一路视频需要写入的数据量
-	var sizePCPD = sizePD / float32(v.ChannelNum)
-
 	// 更加码流+容量+保留期限，换算 支持的视频路数
-	if v.ChannelNum == 0 && v.DataLife > 0 {
+	if v.ChannelNum == 0 {
+		// 每天一路视频需要写入的数据量
+		var sizePCPD = v.AvgBitStream / 8 * 60 * 60 * 24 * 1024 * 1024
 		v.ChannelNum = int((float32(v.SafeWaterCapacity) / v.DataLife) / sizePCPD)
+		if v.ChannelNum == 0 {
+			return fmt.Errorf("安全水位容量 %s 不足以保存一路 %v Mbps 视频 %v 天的数据: 推算视频路数为0",
+				v.SafeWaterCapacityHuman, v.AvgBitStream, v.DataLife)
+		}
+		v.BandWidth = (v.AvgBitStream / 8) * float32(v.ChannelNum)
+		sizePD = v.BandWidth * 60 * 60 * 24 * 1024 * 1024
 	}
-	// 预埋阶段视频路数
-	if v.PrepareChannelNum <= 0 || v.PrepareChannelNum > v.ChannelNum {
+	// 峰值带宽：所有视频同时处于事件中
+	v.PeakBandWidth = (v.peakBitStream() / 8) * float32(v.ChannelNum)
+	// 预埋阶段视频路数，可大于 ChannelNum 以加快预埋
+	if v.PrepareChannelNum <= 0 {
 		v.PrepareChannelNum = v.ChannelNum
 	}
 
@@ -91,16 +213,105 @@ func (v *VideoInfo) CalcData() *VideoInfo {
 	v.ObjNumPC = v.ObjNum / v.ChannelNum
 	v.ObjNumPD = int(uint64(sizePD) / v.FileInfo.Size)
 	v.ObjNumPCPD = v.ObjNumPD / v.ChannelNum
+	if v.ObjNumPC == 0 {
+		return fmt.Errorf("安全水位容量 %s 不足以为 %d 路视频各保存一个 %s 的对象",
+			v.SafeWaterCapacityHuman, v.ChannelNum, humanize.IBytes(v.FileInfo.Size))
+	}
+	if v.ObjNumPCPD == 0 {
+		return fmt.Errorf("对象大小 %s 超过一路 %v Mbps 视频一天的数据量: 每路视频每天对象数为0，无法按日期分目录",
+			humanize.IBytes(v.FileInfo.Size), v.AvgBitStream)
+	}
 
-	// 对象积攒时间间隔
-	v.TimeInterval = float32(v.FileInfo.Size / uint64(v.BitStream/8*1024*1024))
+	// 对象积攒时间间隔，启用事件模型时为平均间隔
+	v.TimeInterval = float32(v.FileInfo.Size) / (v.AvgBitStream / 8 * 1024 * 1024)
 	v.SegmentTimeInterval = v.TimeInterval / float32(v.Segments)
+	if v.Appendable && v.Segments > 1 && v.FileInfo.Size/uint64(v.Segments) < minPartSize {
+		return fmt.Errorf("追加写分片大小 %s 小于多段上传最小分片大小 %s: 除最后一个分片外都会被存储拒绝，请减少分片数(appendable.segments)或增大对象大小",
+			humanize.IBytes(v.FileInfo.Size/uint64(v.Segments)), humanize.IBytes(minPartSize))
+	}
 
 	// 并行数
 	v.MainConcurrent = v.BandWidth / float32(v.FileInfo.Size) * 1024 * 1024
-	v.PrepareConcurrent = float32(v.PrepareChannelNum*int(v.BitStream/8)) / float32(v.FileInfo.Size) * 1024 * 1024
+	v.PrepareConcurrent = float32(v.PrepareChannelNum) * (v.AvgBitStream / 8) / float32(v.FileInfo.Size) * 1024 * 1024
+	return nil
+}
 
-	// 打印计算结果
-	v.printVideoInfo()
-	return v
+// calcGroups 多组视频：指定了保留期限的组按期限占用安全容量，其余组按每天数据量平分剩余安全容量，
+// 分别计算每组的数据模型后汇总总量
+func (v *VideoInfo) calcGroups() error {
+	var fixed, unsetPD float32
+	for i := range v.Groups {
+		g := &v.Groups[i]
+		if err := g.loadFileInfo(); err != nil {
+			return fmt.Errorf("视频组 %s: %w", g.GroupName, err)
+		}
+		if g.BitStream <= 0 {
+			return fmt.Errorf("视频组 %s: 视频码流为 %v Mbps: 应大于0", g.GroupName, g.BitStream)
+		}
+		if err := g.checkEvents(); err != nil {
+			return fmt.Errorf("视频组 %s: %w", g.GroupName, err)
+		}
+		if g.DataLife > 0 {
+			fixed += g.sizePD() * g.DataLife
+		} else {
+			unsetPD += g.sizePD()
+		}
+	}
+	rest := float32(v.SafeWaterCapacity) - fixed
+	if rest < 0 {
+		Logger.Warnf("各组视频保留期限所需容量 %s 超过安全容量 %s", humanize.IBytes(uint64(fixed)), v.SafeWaterCapacityHuman)
+		rest = 0
+	}
+
+	prepareChannelNum := v.PrepareChannelNum
+	v.ChannelNum, v.BucketNum, v.BandWidth, v.PeakBandWidth = 0, 0, 0, 0
+	v.ObjNum, v.ObjNumPD, v.MainConcurrent, v.PrepareConcurrent = 0, 0, 0, 0
+	for i := range v.Groups {
+		g := &v.Groups[i]
+		if g.DataLife > 0 {
+			g.SafeWaterCapacity = uint64(g.sizePD() * g.DataLife)
+		} else {
+			g.SafeWaterCapacity = uint64(rest * g.sizePD() / unsetPD)
+		}
+		g.SafeWaterCapacityHuman = humanize.IBytes(g.SafeWaterCapacity)
+		if g.SafeWaterCapacity == 0 {
+			return fmt.Errorf("视频组 %s: 其他组保留期限已占满安全容量 %s, 该组没有剩余容量", g.GroupName, v.SafeWaterCapacityHuman)
+		}
+		if err := g.calcModel(); err != nil {
+			return fmt.Errorf("视频组 %s: %w", g.GroupName, err)
+		}
+
+		v.ChannelNum += g.ChannelNum
+		v.BandWidth += g.BandWidth
+		v.PeakBandWidth += g.PeakBandWidth
+		v.BucketNum += g.BucketNum
+		v.ObjNum += g.ObjNum
+		v.ObjNumPD += g.ObjNumPD
+		v.MainConcurrent += g.MainConcurrent
+		v.PrepareConcurrent += g.PrepareConcurrent
+		if i == 0 || g.DataLife < v.DataLife {
+			v.DataLife = g.DataLife
+		}
+		if i == 0 || g.TimeInterval < v.TimeInterval {
+			v.TimeInterval = g.TimeInterval
+			v.SegmentTimeInterval = g.SegmentTimeInterval
+		}
+	}
+	if v.SingleBucket {
+		v.BucketNum = 1
+	}
+	// 平均码流
+	v.BitStream = v.BandWidth * 8 / float32(v.ChannelNum)
+	v.AvgBitStream = v.BitStream
+	v.DataLifeHuman = fmt.Sprintf("%.3f", v.DataLife)
+	v.FileInfoHuman = fmt.Sprintf("%d 组视频", len(v.Groups))
+	v.ObjNumPC = v.ObjNum / v.ChannelNum
+	v.ObjNumPCPD = v.ObjNumPD / v.ChannelNum
+	// 预埋阶段视频路数，按比例换算预埋速率
+	v.PrepareChannelNum = prepareChannelNum
+	if v.PrepareChannelNum <= 0 {
+		v.PrepareChannelNum = v.ChannelNum
+	}
+	v.PrepareConcurrent = v.PrepareConcurrent * float32(v.PrepareChannelNum) / float32(v.ChannelNum)
+	return nil
 }
@@ -0,0 +1,53 @@
+package video
+
+import (
+	"stress/models"
+	"stress/pkg/logger"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestCalcDataInvalid(t *testing.T) {
+	logger.Logger = zap.NewNop().Sugar()
+	valid := VideoInfo{
+		VideoBaseInfo: VideoBaseInfo{
+			ChannelNum:     10,
+			BitStream:      4,
+			FileInfo:       models.FileInfo{Size: 128 << 20},
+			TotalCapacity:  1 << 40,
+			SafeWaterLevel: 0.9,
+			Segments:       1,
+		},
+	}
+	tests := []struct {
+		name   string
+		modify func(v *VideoInfo)
+	}{
+		{"no capacity", func(v *VideoInfo) { v.TotalCapacity = 0 }},
+		{"no channels and datalife", func(v *VideoInfo) { v.ChannelNum = 0 }},
+		{"no bitstream", func(v *VideoInfo) { v.BitStream = 0 }},
+		{"no object size", func(v *VideoInfo) { v.FileInfo.Size = 0 }},
+		{"capacity too small", func(v *VideoInfo) { v.ChannelNum, v.DataLife, v.TotalCapacity = 0, 30, 1<<30 }},
+		{"object larger than a day", func(v *VideoInfo) { v.BitStream, v.FileInfo.Size = 0.001, 1<<30 }},
+		{"appendable without multipart", func(v *VideoInfo) { v.Appendable, v.DisableMultipart = true, true }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := valid
+			tt.modify(&v)
+			if err := v.CalcData(); err == nil {
+				t.Errorf("want error, got model %+v", v.VideoDataInfo)
+			}
+		})
+	}
+
+	v := valid
+	v.ChannelNum, v.DataLife = 0, 7
+	if err := v.CalcData(); err != nil {
+		t.Fatal(err)
+	}
+	if v.ChannelNum == 0 || v.BucketNum != v.ChannelNum || v.BandWidth == 0 {
+		t.Errorf("derived channels: %d, buckets: %d, bandwidth: %v", v.ChannelNum, v.BucketNum, v.BandWidth)
+	}
+}
@@ -0,0 +1,95 @@
+// 场景：视频监控 - 断点续跑状态
+package video
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 状态文件记录的运行阶段
+const (
+	StagePrefill = "prefill" // 数据预埋阶段
+	StageMain    = "main"    // 边写边删阶段
+)
+
+// ChannelState 单路视频运行状态
+type ChannelState struct {
+	ChannelID int    `json:"channel_id"`
+	IdxNext   int    `json:"idx_next"`   // 下一个待写入对象序号
+	IdxOldest int    `json:"idx_oldest"` // 最早一个未删除对象序号
+	Date      string `json:"date"`       // 当前模拟日期
+}
+
+// Checkpoint 状态文件内容，用于进程异常退出后断点续跑
+type Checkpoint struct {
+	Time     time.Time      `json:"time"`
+	Stage    string         `json:"stage"`
+	Channels []ChannelState `json:"channels"`
+}
+
+// State 返回当前运行状态
+func (u *VideoWorkflow) State() ChannelState {
+	return ChannelState{
+		ChannelID: u.ChannelID,
+		IdxNext:   u.IdxNext,
+		IdxOldest: u.IdxOldest,
+		Date:      u.Calc_date(u.IdxNext),
+	}
+}
+
+// Restore 从状态文件恢复运行状态。日期按状态文件恢复，
+// 即使模拟时钟起始日期与中断前不同，对象仍写入、删除中断前的日期目录
+func (u *VideoWorkflow) Restore(st ChannelState) error {
+	u.IdxNext = st.IdxNext
+	u.IdxOldest = st.IdxOldest
+	if st.Date == "" {
+		return nil
+	}
+	date, err := time.Parse(layout, st.Date)
+	if err != nil {
+		return fmt.Errorf("invalid date %q of channel %d: %w", st.Date, st.ChannelID, err)
+	}
+	u.start = date.AddDate(0, 0, -st.IdxNext/u.ObjNumPCPD)
+	return nil
+}
+
+// SaveCheckpoint 保存状态文件：先写临时文件再重命名，保证进程被强制杀死时状态文件完整
+func SaveCheckpoint(path string, cp *Checkpoint) error {
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadCheckpoint 读取状态文件
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("parse state file %s: %w", path, err)
+	}
+	return &cp, nil
+}
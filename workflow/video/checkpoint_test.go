@@ -0,0 +1,62 @@
+package video
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	base := VideoWorkflow{
+		VideoInfo: VideoInfo{
+			VideoDataInfo:      VideoDataInfo{ObjNumPC: 3, ObjNumPCPD: 2},
+			VideoCustomizeInfo: VideoCustomizeInfo{BucketPrefix: "bucket", ObjPrefix: "data", ObjIdxWidth: 3, ObjIdxStart: 1},
+		},
+	}
+	vc := base.NewChannel(2)
+	for i := 0; i < 5; i++ {
+		vc.IdxNext++
+		if idx, ok := vc.NextDelete(); ok {
+			vc.Deleted(idx)
+		}
+	}
+	if vc.IdxNext != 6 || vc.IdxOldest != 3 {
+		t.Fatalf("unexpected state: next=%d, oldest=%d", vc.IdxNext, vc.IdxOldest)
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	err := SaveCheckpoint(path, &Checkpoint{Time: time.Now(), Stage: StageMain, Channels: []ChannelState{vc.State()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Stage != StageMain || len(cp.Channels) != 1 {
+		t.Fatalf("unexpected checkpoint: %+v", cp)
+	}
+	if want := "2023-01-04"; cp.Channels[0].Date != want {
+		t.Errorf("date: got %s, want %s", cp.Channels[0].Date, want)
+	}
+
+	// 模拟时钟起始日期与中断前不同时，按状态文件中的日期继续
+	clock, err := NewSimClock("2024-06-01", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed := base.NewChannel(2)
+	resumed.Clock = clock
+	if err := resumed.Restore(cp.Channels[0]); err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Calc_obj_path(resumed.IdxOldest) != vc.Calc_obj_path(vc.IdxOldest) {
+		t.Errorf("oldest object: got %s, want %s", resumed.Calc_obj_path(resumed.IdxOldest), vc.Calc_obj_path(vc.IdxOldest))
+	}
+	if resumed.Calc_obj_path(resumed.IdxNext) != vc.Calc_obj_path(vc.IdxNext) {
+		t.Errorf("next object: got %s, want %s", resumed.Calc_obj_path(resumed.IdxNext), vc.Calc_obj_path(vc.IdxNext))
+	}
+	if idx, ok := resumed.NextDelete(); ok {
+		t.Errorf("unexpected delete of %d before next write", idx)
+	}
+}
@@ -0,0 +1,65 @@
+// 场景：视频监控 - 模拟时钟
+package video
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SimClock 模拟时钟：视频对象的日期从 Start 开始按对象序号推算，运行时按 Speedup 倍速流逝，
+// 用于在几个小时内回放一个完整保留周期的按日期目录变化（建目录、跨天、删除旧目录）
+type SimClock struct {
+	Start   time.Time // 模拟起始日期，即第0个对象所在日期
+	Speedup float64   // 加速倍数，1表示与实际时间相同
+
+	mu   sync.Mutex
+	base time.Time // Begin 时的实际时间
+	at   time.Time // Begin 时的模拟时间
+}
+
+// defaultClock 未指定模拟时钟时使用
+var defaultClock = &SimClock{Start: mustParseDate(DefaultSimStart), Speedup: 1}
+
+func mustParseDate(date string) time.Time {
+	t, err := time.Parse(layout, date)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// NewSimClock 创建模拟时钟，start 格式为 2006-01-02
+func NewSimClock(start string, speedup float64) (*SimClock, error) {
+	t, err := time.Parse(layout, start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid simulated start date %q, want format %s: %w", start, layout, err)
+	}
+	if speedup <= 0 {
+		return nil, fmt.Errorf("invalid simulated clock speedup %v, must be greater than 0", speedup)
+	}
+	return &SimClock{Start: t, Speedup: speedup}, nil
+}
+
+// Begin 从模拟时间 at 开始计时
+func (c *SimClock) Begin(at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.base = time.Now()
+	c.at = at
+}
+
+// Now 返回当前模拟时间，Begin 之前（模拟尚未开始）为实际时间
+func (c *SimClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.base.IsZero() {
+		return time.Now()
+	}
+	return c.at.Add(time.Duration(float64(time.Since(c.base)) * c.Speedup))
+}
+
+// Real 返回模拟时长 d 对应的实际时长
+func (c *SimClock) Real(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / c.Speedup)
+}
@@ -0,0 +1,44 @@
+package video
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimClock(t *testing.T) {
+	clock, err := NewSimClock("2023-03-30", 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc := (&VideoWorkflow{
+		VideoInfo: VideoInfo{
+			VideoDataInfo:      VideoDataInfo{ObjNumPCPD: 24, TimeInterval: 3600},
+			VideoCustomizeInfo: VideoCustomizeInfo{ObjPrefix: "data", ObjIdxWidth: 3},
+		},
+		Clock: clock,
+	}).NewChannel(0)
+
+	if got, want := vc.Calc_obj_path(48), "2023-04-01/data-ch0048"; got != want {
+		t.Errorf("path: got %s, want %s", got, want)
+	}
+	if got, want := vc.ObjInterval(), time.Second; got != want {
+		t.Errorf("interval: got %v, want %v", got, want)
+	}
+	if got, want := vc.Calc_time(47), time.Date(2023, 3, 31, 23, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("time: got %v, want %v", got, want)
+	}
+
+	// 一秒实际时间对应一小时模拟时间，跨天后模拟日期随之变化
+	clock.Begin(vc.Calc_time(23))
+	if got, want := clock.Now().Format(layout), "2023-03-30"; got != want {
+		t.Errorf("date: got %s, want %s", got, want)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if got, want := clock.Now().Format(layout), "2023-03-31"; got != want {
+		t.Errorf("date after rollover: got %s, want %s", got, want)
+	}
+
+	if _, err := NewSimClock("2023-1-1", 1); err == nil {
+		t.Error("want error for invalid date")
+	}
+}
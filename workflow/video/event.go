@@ -0,0 +1,134 @@
+// 场景：视频监控 - 移动侦测事件录像模型
+package video
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// hasEvents 是否启用移动侦测事件模型
+func (v *VideoInfo) hasEvents() bool {
+	return v.EventRate > 0
+}
+
+// checkEvents 校验事件模型参数
+func (v *VideoInfo) checkEvents() error {
+	if v.EventRate < 0 {
+		return fmt.Errorf("事件频率(event.rate)为 %v: 不能为负数", v.EventRate)
+	}
+	if !v.hasEvents() {
+		if v.MotionOnly {
+			return errors.New("仅事件录像(event.motion-only)需要指定事件频率(event.rate)")
+		}
+		return nil
+	}
+	if v.EventDuration <= 0 {
+		return fmt.Errorf("事件平均时长(event.duration)为 %v 秒: 应大于0", v.EventDuration)
+	}
+	if v.EventMultiplier <= 0 {
+		return fmt.Errorf("事件码流倍数(event.multiplier)为 %v: 应大于0", v.EventMultiplier)
+	}
+	return nil
+}
+
+// eventDuty 处于事件中的时间占比：空闲与事件交替，平均空闲时长为 1/EventRate
+func (v *VideoInfo) eventDuty() float32 {
+	if !v.hasEvents() {
+		return 0
+	}
+	idle := 3600 / v.EventRate
+	return v.EventDuration / (v.EventDuration + idle)
+}
+
+// idleFactor 非事件期间的码流倍数，仅事件录像时为0
+func (v *VideoInfo) idleFactor() float32 {
+	if v.MotionOnly {
+		return 0
+	}
+	return 1
+}
+
+// avgBitStream 平均码流，未启用事件模型时即为 BitStream
+func (v *VideoInfo) avgBitStream() float32 {
+	if !v.hasEvents() {
+		return v.BitStream
+	}
+	duty := v.eventDuty()
+	return v.BitStream * ((1-duty)*v.idleFactor() + duty*v.EventMultiplier)
+}
+
+// peakBitStream 一路视频的峰值码流
+func (v *VideoInfo) peakBitStream() float32 {
+	if !v.hasEvents() || v.EventMultiplier < v.idleFactor() {
+		return v.BitStream * v.idleFactor()
+	}
+	return v.BitStream * v.EventMultiplier
+}
+
+// EventTimeline 一路视频的移动侦测事件过程：空闲与事件交替出现，事件按泊松过程到达，
+// 空闲和事件时长均服从指数分布。按当前状态的码流积攒数据，决定对象产生的时间和大小
+type EventTimeline struct {
+	v       *VideoInfo
+	rng     *rand.Rand
+	inEvent bool
+	left    float64 // 当前状态剩余的视频时长，单位：秒
+}
+
+// NewEventTimeline 创建一路视频的事件过程，未启用事件模型时返回 nil
+func (v *VideoInfo) NewEventTimeline(seed int64) *EventTimeline {
+	if !v.hasEvents() {
+		return nil
+	}
+	t := &EventTimeline{v: v, rng: rand.New(rand.NewSource(seed))}
+	// 按稳态概率决定起始状态：切换后处于事件中的概率为 eventDuty
+	t.inEvent = t.rng.Float32() >= v.eventDuty()
+	t.toggle()
+	return t
+}
+
+// rate 当前状态下每秒产生的数据量，单位 byte
+func (t *EventTimeline) rate() float64 {
+	factor := t.v.idleFactor()
+	if t.inEvent {
+		factor = t.v.EventMultiplier
+	}
+	return float64(t.v.BitStream*factor) / 8 * 1024 * 1024
+}
+
+// toggle 切换到下一个状态，并抽样其时长
+func (t *EventTimeline) toggle() {
+	t.inEvent = !t.inEvent
+	if t.inEvent {
+		t.left = t.rng.ExpFloat64() * float64(t.v.EventDuration)
+	} else {
+		t.left = t.rng.ExpFloat64() * 3600 / float64(t.v.EventRate)
+	}
+}
+
+// Next 积攒一个 size 字节的对象，返回所需的视频时长和对象实际大小。
+// cut 为 true 且仅事件录像时，事件结束即产生对象，对象可能小于 size
+func (t *EventTimeline) Next(size int64, cut bool) (time.Duration, int64) {
+	var got, elapsed float64
+	for {
+		if t.left <= 0 {
+			if cut && t.inEvent && t.v.MotionOnly && got >= 1 {
+				t.toggle()
+				return time.Duration(elapsed * float64(time.Second)), int64(got)
+			}
+			t.toggle()
+		}
+		r := t.rate()
+		if r > 0 {
+			if need := (float64(size) - got) / r; need <= t.left {
+				t.left -= need
+				elapsed += need
+				return time.Duration(elapsed * float64(time.Second)), size
+			}
+			got += r * t.left
+		}
+		elapsed += t.left
+		t.left = 0
+	}
+}
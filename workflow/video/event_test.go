@@ -0,0 +1,76 @@
+package video
+
+import (
+	"math"
+	"stress/models"
+	"stress/pkg/logger"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestEvents(t *testing.T) {
+	logger.Logger = zap.NewNop().Sugar()
+	v := VideoInfo{
+		VideoBaseInfo: VideoBaseInfo{
+			ChannelNum:      10,
+			BitStream:       4,
+			FileInfo:        models.FileInfo{Size: 16 << 20},
+			TotalCapacity:   1 << 40,
+			SafeWaterLevel:  0.9,
+			Segments:        1,
+			EventRate:       6,
+			EventDuration:   200,
+			EventMultiplier: 3,
+		},
+	}
+	// 每小时 6 次、每次 200 秒：事件占比 200/(200+600)=25%，平均码流 4*(0.75+0.25*3)=6 Mbps
+	if err := v.CalcData(); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(float64(v.AvgBitStream)-6) > 1e-3 {
+		t.Errorf("want average bitstream 6 Mbps, got %v", v.AvgBitStream)
+	}
+	if math.Abs(float64(v.BandWidth)-7.5) > 1e-3 || math.Abs(float64(v.PeakBandWidth)-15) > 1e-3 {
+		t.Errorf("want bandwidth 7.5/15 MiB/s, got %v/%v", v.BandWidth, v.PeakBandWidth)
+	}
+
+	// 事件过程产生的数据总量与平均码流一致
+	tl := v.NewEventTimeline(1)
+	var total time.Duration
+	for i := 0; i < 20000; i++ {
+		d, size := tl.Next(int64(v.FileInfo.Size), true)
+		if size != int64(v.FileInfo.Size) {
+			t.Fatalf("want full object without motion-only, got %d", size)
+		}
+		total += d
+	}
+	if avg := total.Seconds() / 20000; math.Abs(avg-float64(v.TimeInterval))/float64(v.TimeInterval) > 0.05 {
+		t.Errorf("want average interval %vs, got %vs", v.TimeInterval, avg)
+	}
+
+	// 仅事件录像：事件结束时产生不足一个对象大小的数据
+	v.MotionOnly = true
+	if err := v.CalcData(); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(float64(v.AvgBitStream)-3) > 1e-3 || math.Abs(float64(v.PeakBandWidth)-15) > 1e-3 {
+		t.Errorf("want motion-only average 3 Mbps, peak 15 MiB/s, got %v/%v", v.AvgBitStream, v.PeakBandWidth)
+	}
+	tl = v.NewEventTimeline(1)
+	var cut int
+	for i := 0; i < 1000; i++ {
+		if _, size := tl.Next(int64(v.FileInfo.Size), true); size < int64(v.FileInfo.Size) {
+			cut++
+		}
+	}
+	if cut == 0 {
+		t.Error("want objects cut at the end of events")
+	}
+
+	v.EventRate = 0
+	if err := v.CalcData(); err == nil {
+		t.Error("want error for motion-only without events")
+	}
+}
@@ -11,14 +11,19 @@ type VideoBaseInfo struct {
 	FileInfo   models.FileInfo `json:"FileInfo"`   // 源文件信息\Reader
 	Segments   int             `json:"追加分片数"`      // 追加写模式下，一个对象追加分片次数
 
+	EventRate       float32 `json:"事件频率(次/小时)"` // 移动侦测事件频率，每路视频每小时平均事件数，0表示恒定码流
+	EventDuration   float32 `json:"事件平均时长(s)"`  // 事件平均持续时长，单位：秒
+	EventMultiplier float32 `json:"事件码流倍数"`     // 事件期间码流为 BitStream 的倍数
+	MotionOnly      bool    `json:"仅事件录像"`      // 仅在事件期间录像，非事件期间不产生数据
+
 	TotalCapacity     uint64  `json:"TotalCapacity"`     // 存储池总容量大小，单位 byte
 	SafeWaterLevel    float32 `json:"SafeWaterLevel"`    // 安全水位，即数据写入存储池的数据量最大不超过总容量的百分比，例如 90%=0.9
 	SafeWaterCapacity uint64  `json:"SafeWaterCapacity"` // 安全水位存储池容量大小，单位 byte; SafeWaterCapacity=TotalCapacity*SafeWaterLevel
 
-	Appendable       bool `json:"追加写模式"`  // 追加写模式
-	DisableMultipart bool `json:"非多段上传"`  // 非多段上传，与追加写互斥
-	SingleBucket     bool `json:"单桶模式"`   // 单桶模式，即所有数据存储在同一个桶中的不同路径
-	SingleBucketName bool `json:"单桶模式桶名"` // 单桶模式，即所有数据存储在同一个桶中的不同路径
+	Appendable       bool   `json:"追加写模式"`  // 追加写模式
+	DisableMultipart bool   `json:"非多段上传"`  // 非多段上传，与追加写互斥
+	SingleBucket     bool   `json:"单桶模式"`   // 单桶模式，即所有数据存储在同一个桶中的不同路径
+	SingleBucketName string `json:"单桶模式桶名"` // 单桶模式下的桶名
 
 	// 仅用于打印
 	FileInfoHuman          string `json:"源文件信息"`   // 源文件信息
@@ -30,7 +35,9 @@ type VideoBaseInfo struct {
 
 // VideoDataInfo 数据模型信息 -- 原始需求信息分解后计算得出
 type VideoDataInfo struct {
-	BandWidth           float32 `json:"总带宽(MiB/s)"`  // 带宽， MiB/s
+	BandWidth           float32 `json:"总带宽(MiB/s)"`  // 带宽， MiB/s；启用事件模型时为平均带宽
+	PeakBandWidth       float32 `json:"峰值带宽(MiB/s)"` // 所有视频同时处于事件中的峰值带宽， MiB/s
+	AvgBitStream        float32 `json:"平均码流(Mbps)"`  // 一路视频的平均码流，未启用事件模型时即为 BitStream
 	BucketNum           int     `json:"桶数量"`         // 桶数量
 	ObjNum              int     `json:"总对象数"`        // 安全水位能写入的总对象数量，达到该数量后需要 边写边删
 	ObjNumPC            int     `json:"每路视频对象数"`     // 安全水位每路视频能写入的对象数量
@@ -59,4 +66,8 @@ type VideoInfo struct {
 	VideoBaseInfo
 	VideoDataInfo
 	VideoCustomizeInfo
+
+	// 多组视频场景：各组的数据模型，此时以上字段为所有组的汇总
+	GroupName string
+	Groups    []VideoInfo
 }
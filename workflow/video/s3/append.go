@@ -0,0 +1,196 @@
+package s3worker
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"stress/pkg/bench"
+	"stress/pkg/generator"
+	"stress/workflow/video"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// 追加写模式下的操作类型
+const (
+	opMPInit   = "MPINIT"   // 第一个分片到达时，创建多段上传
+	opPutPart  = "PUTPART"  // 上传一个分片
+	opComplete = "COMPLETE" // 最后一个分片到达后，完成多段上传
+)
+
+// appendUpload 追加写模式下，一路视频正在写入的一个对象
+type appendUpload struct {
+	idx      int              // 对象序号
+	src      generator.Source // 对象写完前独占的数据源
+	finished int32            // 对象已结束（成功或失败）
+	obj      *generator.Object
+	bucket   string
+	uploadID string
+	parts    []minio.CompletePart
+	md5      string // 抽样读回校验时对象内容的 MD5
+	hold     bool   // 设置了合法保留
+	partMd5  bool   // 分片须携带 Content-MD5（带保留设置的上传）
+}
+
+// appendSegment 追加写模式：以多段上传的方式写入当前对象的第 seg 个分片（从0开始），
+// 第一个分片时创建多段上传，最后一个分片后完成上传。completed 表示当前对象已结束（成功或失败）
+func (u *VideoS3Workflow) appendSegment(vc *video.VideoWorkflow, app *appendUpload, seg, segments int, thread uint16) (ops []bench.Operation, completed bool) {
+	// Non-terminating context, only canceled if the operation does not finish in time after an interrupt.
+	nonTerm := u.RequestContext()
+	last := seg == segments-1
+
+	client, cldone := u.S3Client()
+	defer cldone()
+	core := minio.Core{Client: client}
+
+	if seg == 0 {
+		app.obj = app.src.Object()
+		app.obj.Name = vc.Calc_obj_path(app.idx)
+		app.bucket = vc.Calc_bucket_name()
+		app.parts = app.parts[:0]
+		app.md5 = ""
+		u.addPrefix(app.bucket, app.obj.Name)
+		if u.verify.sample() {
+			var err error
+			if app.md5, err = objectMd5(app.obj); err != nil {
+				u.Error("verify md5 error: ", err)
+			}
+		}
+		opts := u.PutOpts
+		opts.ContentType = app.obj.ContentType
+		app.hold = u.lock.apply(vc, &opts)
+		app.partMd5 = opts.SendContentMd5
+		start := time.Now()
+		var uploadID string
+		attempts, err, lastErr := u.RetryPolicy(opMPInit).Do(nonTerm, func() error {
+			var err error
+			uploadID, err = core.NewMultipartUpload(nonTerm, app.bucket, app.obj.Name, opts)
+			return err
+		})
+		op := bench.Operation{
+			OpType:   opMPInit,
+			Thread:   thread,
+			Channel:  vc.ChannelName,
+			File:     app.obj.Name,
+			ObjPerOp: 1,
+			Endpoint: client.EndpointURL().String(),
+			Start:    start,
+			End:      time.Now(),
+		}
+		op.Record(attempts, err, lastErr)
+		ops = append(ops, op)
+		if err != nil {
+			u.Error("new multipart upload error: ", err)
+		}
+		app.uploadID = uploadID
+	}
+	// 当前对象已失败，跳过剩余分片
+	if app.uploadID == "" {
+		return ops, last
+	}
+
+	partSize := app.obj.Size / int64(segments)
+	if last {
+		partSize = app.obj.Size - partSize*int64(segments-1)
+	}
+	op := bench.Operation{
+		OpType:   opPutPart,
+		Thread:   thread,
+		Channel:  vc.ChannelName,
+		Size:     partSize,
+		File:     app.obj.Name,
+		ObjPerOp: 1,
+		Endpoint: client.EndpointURL().String(),
+	}
+	op.Start = time.Now()
+	var part minio.ObjectPart
+	attempts, err, lastErr := u.RetryPolicy(opPutPart).Do(nonTerm, func() error {
+		// 重试时从分片开头上传
+		offset := int64(seg) * (app.obj.Size / int64(segments))
+		if _, err := app.obj.Reader.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		partOpts := minio.PutObjectPartOptions{SSE: u.PutOpts.ServerSideEncryption}
+		if app.partMd5 {
+			var err error
+			if partOpts.Md5Base64, err = partMd5(app.obj.Reader, offset, partSize); err != nil {
+				return err
+			}
+		}
+		var err error
+		part, err = core.PutObjectPart(nonTerm, app.bucket, app.obj.Name, app.uploadID, seg+1,
+			io.LimitReader(app.obj.Reader, partSize), partSize, partOpts)
+		return err
+	})
+	op.End = time.Now()
+	op.Record(attempts, err, lastErr)
+	if err != nil {
+		u.Error("upload part error: ", err)
+		ops = append(ops, op)
+		u.abortAppend(app)
+		return ops, last
+	}
+	ops = append(ops, op)
+	app.parts = append(app.parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+	if !last {
+		return ops, false
+	}
+
+	op = bench.Operation{
+		OpType:   opComplete,
+		Thread:   thread,
+		Channel:  vc.ChannelName,
+		File:     app.obj.Name,
+		ObjPerOp: 1,
+		Endpoint: client.EndpointURL().String(),
+	}
+	op.Start = time.Now()
+	attempts, err, lastErr = u.RetryPolicy(opComplete).Do(nonTerm, func() error {
+		_, err := core.CompleteMultipartUpload(nonTerm, app.bucket, app.obj.Name, app.uploadID, app.parts, u.PutOpts)
+		return err
+	})
+	op.End = time.Now()
+	op.Record(attempts, err, lastErr)
+	if err != nil {
+		u.Error("complete multipart upload error: ", err)
+		u.abortAppend(app)
+	} else {
+		if app.hold {
+			u.lock.addHeld(app.bucket, app.obj.Name)
+		}
+		if app.md5 != "" {
+			// 多段上传的 ETag 不是内容 MD5，只校验大小和 MD5
+			u.verify.add(verifyJob{vc: vc, idx: app.idx, bucket: app.bucket, name: app.obj.Name, size: app.obj.Size, md5: app.md5})
+		}
+	}
+	app.uploadID = ""
+	return append(ops, op), true
+}
+
+// abortAppend 放弃当前对象未完成的多段上传
+func (u *VideoS3Workflow) abortAppend(app *appendUpload) {
+	if app.uploadID == "" {
+		return
+	}
+	client, cldone := u.S3Client()
+	defer cldone()
+	core := minio.Core{Client: client}
+	if err := core.AbortMultipartUpload(context.Background(), app.bucket, app.obj.Name, app.uploadID); err != nil {
+		u.Error("abort multipart upload error: ", err)
+	}
+	app.uploadID = ""
+}
+
+// partMd5 返回从 offset 开始 size 字节分片的 Content-MD5，读取后回到 offset
+func partMd5(r io.ReadSeeker, offset, size int64) (string, error) {
+	h := md5.New()
+	if _, err := io.CopyN(h, r, size); err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,252 @@
+package s3worker
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	. "stress/pkg/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/minio/minio-go/v7"
+)
+
+// 容量统计来源
+const (
+	CapacitySourceUsage = "usage" // madmin DataUsageInfo，集群所有桶，随后台扫描更新
+	CapacitySourceList  = "list"  // 列举本次写入的对象累加大小
+)
+
+// 超过安全水位后的处理方式
+const (
+	CapacityActionSkip   = "skip"   // 跳过写入，丢弃超过期间产生的对象（数据预埋阶段暂停写入）
+	CapacityActionDelete = "delete" // 每写入一个对象额外删除一个最早的对象
+)
+
+// capacitySample 一次容量采样
+type capacitySample struct {
+	Time    time.Time
+	Used    uint64
+	Objects uint64
+	Over    bool
+	Err     string
+}
+
+// capacityMonitor 定期统计已用容量，超过安全水位（SafeWaterCapacity）时通知写入流程限流。
+// 稳定运行时已用容量就在安全水位附近（先写后删），超过安全水位加上每路视频一个对象的余量才限流，
+// 回落到安全水位以下时恢复
+type capacityMonitor struct {
+	u       *VideoS3Workflow
+	limit   uint64 // 安全水位
+	high    uint64 // 开始限流的容量
+	over    int32
+	skipped int64 // 因超过安全水位而跳过的对象数
+	mu      sync.Mutex
+	samples []capacitySample
+}
+
+// runCapacity 启动容量监控，直到 ctx 结束，返回的函数等待监控退出。
+// 未设置集群容量或采样间隔时不监控
+func (u *VideoS3Workflow) runCapacity(ctx context.Context, stage string) (wait func()) {
+	if u.CapacityInterval <= 0 || u.SafeWaterCapacity == 0 {
+		return func() {}
+	}
+	u.stateMu.Lock()
+	if u.capacity == nil {
+		u.capacity = &capacityMonitor{u: u, limit: u.SafeWaterCapacity, high: u.SafeWaterCapacity}
+		for _, vc := range u.channels {
+			u.capacity.high += vc.FileInfo.Size
+		}
+	}
+	m := u.capacity
+	u.stateMu.Unlock()
+	Logger.Infof("Stage-%s:capacity monitor every %v, source: %s, safe water: %s, throttle above: %s, action: %s",
+		stage, u.CapacityInterval, u.CapacitySource, humanize.IBytes(m.limit), humanize.IBytes(m.high), u.CapacityAction)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(u.CapacityInterval)
+		defer ticker.Stop()
+		for {
+			m.sample(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() { <-done }
+}
+
+// sample 统计一次已用容量并更新水位状态
+func (m *capacityMonitor) sample(ctx context.Context) {
+	s := capacitySample{Time: time.Now()}
+	var err error
+	switch m.u.CapacitySource {
+	case CapacitySourceList:
+		s.Used, s.Objects, err = m.u.listUsage(ctx)
+	default:
+		s.Used, s.Objects, err = m.u.dataUsage(ctx)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		s.Err = err.Error()
+		Logger.Errorf("Capacity:measure used capacity error: %v", err)
+	} else {
+		// 限流开始后，回落到安全水位以下才恢复
+		s.Over = s.Used > m.high || (m.isOver() && s.Used > m.limit)
+		if s.Over != m.isOver() {
+			if s.Over {
+				Logger.Warnf("Capacity:used %s exceeded safe water %s, %s", humanize.IBytes(s.Used), humanize.IBytes(m.limit), m.u.CapacityAction)
+			} else {
+				Logger.Infof("Capacity:used %s below safe water %s, resume", humanize.IBytes(s.Used), humanize.IBytes(m.limit))
+			}
+		}
+		var over int32
+		if s.Over {
+			over = 1
+		}
+		atomic.StoreInt32(&m.over, over)
+	}
+	m.mu.Lock()
+	m.samples = append(m.samples, s)
+	m.mu.Unlock()
+}
+
+// isOver 最近一次采样是否超过安全水位
+func (m *capacityMonitor) isOver() bool {
+	return m != nil && atomic.LoadInt32(&m.over) == 1
+}
+
+// skip 超过安全水位且处理方式为跳过写入时返回 true，并记录跳过的对象
+func (m *capacityMonitor) skip() bool {
+	if m.isOver() && m.u.CapacityAction != CapacityActionDelete {
+		atomic.AddInt64(&m.skipped, 1)
+		return true
+	}
+	return false
+}
+
+// speedDelete 超过安全水位且处理方式为加速删除时返回 true
+func (m *capacityMonitor) speedDelete() bool {
+	return m.isOver() && m.u.CapacityAction == CapacityActionDelete
+}
+
+// waitBelow 超过安全水位时阻塞，直到容量回落或 ctx 结束
+func (m *capacityMonitor) waitBelow(ctx context.Context) {
+	if !m.isOver() {
+		return
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for m.isOver() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dataUsage 通过 madmin DataUsageInfo 获取集群已用容量
+func (u *VideoS3Workflow) dataUsage(ctx context.Context) (uint64, uint64, error) {
+	if u.AdminClient == nil {
+		return 0, 0, fmt.Errorf("admin client not set")
+	}
+	info, err := u.AdminClient.DataUsageInfo(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return info.ObjectsTotalSize, info.ObjectsTotalCount, nil
+}
+
+// listUsage 列举本次写入过的桶和目录，累加对象大小
+func (u *VideoS3Workflow) listUsage(ctx context.Context) (uint64, uint64, error) {
+	u.prefixesMu.Lock()
+	prefixes := make(map[string][]string, len(u.prefixes))
+	for bucket, pfs := range u.prefixes {
+		for p := range pfs {
+			prefixes[bucket] = append(prefixes[bucket], p)
+		}
+	}
+	u.prefixesMu.Unlock()
+
+	client, cldone := u.S3Client()
+	defer cldone()
+	var used, objects uint64
+	for bucket, pfs := range prefixes {
+		for _, p := range pfs {
+			for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: p + "/", Recursive: true}) {
+				if obj.Err != nil {
+					return used, objects, obj.Err
+				}
+				used += uint64(obj.Size)
+				objects++
+			}
+		}
+	}
+	return used, objects, nil
+}
+
+// status 最近一次容量采样，没有采样时返回空字符串
+func (m *capacityMonitor) status() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.samples) == 0 {
+		return ""
+	}
+	s := m.samples[len(m.samples)-1]
+	if s.Err != "" {
+		return "capacity: " + s.Err
+	}
+	return fmt.Sprintf("capacity used %s (%.2f%% of safe water), %d objects", humanize.IBytes(s.Used), float64(s.Used)*100/float64(m.limit), s.Objects)
+}
+
+// writeCapacity 将容量曲线写入 CSV 文件
+func (m *capacityMonitor) writeCapacity(fileName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.samples) == 0 {
+		return nil
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"time", "used_bytes", "objects", "safe_water_bytes", "throttle_bytes", "over", "error"})
+	var maxUsed uint64
+	var overN int
+	for _, s := range m.samples {
+		w.Write([]string{
+			s.Time.Format(time.RFC3339Nano),
+			strconv.FormatUint(s.Used, 10),
+			strconv.FormatUint(s.Objects, 10),
+			strconv.FormatUint(m.limit, 10),
+			strconv.FormatUint(m.high, 10),
+			strconv.FormatBool(s.Over),
+			s.Err,
+		})
+		if s.Used > maxUsed {
+			maxUsed = s.Used
+		}
+		if s.Over {
+			overN++
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	Logger.Infof("Capacity:%d samples, max used %s (%.2f%% of safe water), %d samples over safe water, %d objects skipped, written to %s",
+		len(m.samples), humanize.IBytes(maxUsed), float64(maxUsed)*100/float64(m.limit), overN, atomic.LoadInt64(&m.skipped), fileName)
+	return nil
+}
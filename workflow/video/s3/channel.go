@@ -0,0 +1,160 @@
+package s3worker
+
+import (
+	"context"
+	"stress/pkg/bench"
+	"stress/pkg/generator"
+	"stress/workflow/video"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// backlogInterval 检查写入积压的间隔
+const backlogInterval = 10 * time.Second
+
+// channelWriter 一路视频的写入：按码流产生的对象（分片）提交到该路视频的任务队列，
+// 由最多 MaxWorkers 个处理协程并行写入，写入结束后按保留期限删除最早的对象
+type channelWriter struct {
+	u      *VideoS3Workflow
+	vc     *video.VideoWorkflow
+	ctx    context.Context
+	q      *video.ChannelQueue
+	thread uint16
+	rcv    chan<- bench.Operation
+	srcs   chan generator.Source // 空闲的数据源，每个处理协程同时只使用一个
+	delMu  sync.Mutex            // 同一路视频的删除按顺序进行
+	apps   []*appendUpload       // 追加写模式下未结束的对象
+}
+
+// newChannelWriter 为一路视频创建任务队列并启动处理协程
+func (u *VideoS3Workflow) newChannelWriter(ctx context.Context, vc *video.VideoWorkflow, thread uint16, rcv chan<- bench.Operation) *channelWriter {
+	workers := vc.MaxWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	return &channelWriter{
+		u:      u,
+		vc:     vc,
+		ctx:    ctx,
+		q:      u.pool.Channel(ctx, vc),
+		thread: thread,
+		rcv:    rcv,
+		srcs:   make(chan generator.Source, workers),
+	}
+}
+
+// source 取一个空闲的数据源，没有时新建
+func (w *channelWriter) source() generator.Source {
+	select {
+	case src := <-w.srcs:
+		return src
+	default:
+		return w.u.newSource(w.vc)
+	}
+}
+
+// putSource 归还数据源
+func (w *channelWriter) putSource(src generator.Source) {
+	select {
+	case w.srcs <- src:
+	default:
+	}
+}
+
+// submitPut 提交写入第 idx 个对象的任务，size 大于0时只写入前 size 字节
+func (w *channelWriter) submitPut(idx int, size int64, due time.Time) bool {
+	return w.q.Submit(w.ctx, video.Task{Run: func() {
+		src := w.source()
+		op := w.u.putObject(w.vc, src, idx, size, w.thread)
+		w.putSource(src)
+		op.Due = &due
+		w.rcv <- op
+		if op.ErrClass == bench.ErrClassCanceled {
+			// 中断时被中止的写入不记录进度，断点续跑时重新写入
+			return
+		}
+		w.finish(idx)
+	}})
+}
+
+// newAppend 追加写模式下开始第 idx 个对象
+func (w *channelWriter) newAppend(idx int) *appendUpload {
+	apps := w.apps[:0]
+	for _, app := range w.apps {
+		if atomic.LoadInt32(&app.finished) == 0 {
+			apps = append(apps, app)
+		}
+	}
+	app := &appendUpload{idx: idx}
+	w.apps = append(apps, app)
+	return app
+}
+
+// submitSegment 提交追加写第 seg 个分片的任务：prev 关闭后开始，写完后关闭 done
+func (w *channelWriter) submitSegment(app *appendUpload, seg, segments int, due time.Time, prev <-chan struct{}, done chan struct{}) bool {
+	return w.q.Submit(w.ctx, video.Task{Ready: prev, Run: func() {
+		defer close(done)
+		if seg == 0 {
+			app.src = w.source()
+		}
+		ops, completed := w.u.appendSegment(w.vc, app, seg, segments, w.thread)
+		aborted := false
+		for _, op := range ops {
+			op.Due = &due
+			w.rcv <- op
+			aborted = aborted || op.ErrClass == bench.ErrClassCanceled
+		}
+		if !completed || aborted {
+			return
+		}
+		w.putSource(app.src)
+		atomic.StoreInt32(&app.finished, 1)
+		w.finish(app.idx)
+	}})
+}
+
+// finish 第 idx 个对象写入结束后，达到安全水位时边写边删
+func (w *channelWriter) finish(idx int) {
+	u, vc := w.u, w.vc
+	u.written(vc, idx)
+
+	w.delMu.Lock()
+	defer w.delMu.Unlock()
+	for {
+		idx, ok := u.nextDelete(vc)
+		if !ok {
+			break
+		}
+		// 生命周期过期模式下由存储删除，只更新保留窗口
+		if u.Retention != video.RetentionLifecycle {
+			w.rcv <- u.deleteObject(vc, idx, w.thread)
+		}
+		u.deleted(vc, idx)
+	}
+	if u.Retention == video.RetentionLifecycle {
+		return
+	}
+	// 超过安全水位时加速删除：额外删除一个最早的对象
+	if !u.WriteOnly && u.capacity.speedDelete() {
+		u.stateMu.Lock()
+		idx, ok := vc.IdxOldest, vc.IdxNext-vc.IdxOldest > 1
+		u.stateMu.Unlock()
+		if ok {
+			w.rcv <- u.deleteObject(vc, idx, w.thread)
+			u.deleted(vc, idx)
+		}
+	}
+	// 删除被对象锁定拒绝的对象不阻塞保留窗口，保留期限结束后重新删除
+	for _, r := range u.lock.expired(time.Now()) {
+		w.rcv <- u.removeObject(r.vc, r.bucket, r.name, r.versionID, w.thread)
+	}
+}
+
+// close 等待处理协程退出，放弃未完成的追加写对象
+func (w *channelWriter) close() {
+	w.q.Wait()
+	for _, app := range w.apps {
+		w.u.abortAppend(app)
+	}
+}
@@ -0,0 +1,316 @@
+package s3worker
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	. "stress/pkg/logger"
+	"stress/workflow/video"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+)
+
+// lifecycleRuleID 本工具安装的生命周期规则 ID
+const lifecycleRuleID = "video-datalife-expiry"
+
+// lifecycleDays 一路视频的生命周期过期天数：保留期限向上取整，至少1天
+func lifecycleDays(vc *video.VideoWorkflow) int {
+	days := int(math.Ceil(float64(vc.DataLife)))
+	if days < 1 {
+		days = 1
+	}
+	return days
+}
+
+// expectedExpiry 生命周期规则的预期过期时间：对象创建时间加上天数后，取下一个 UTC 零点
+func expectedExpiry(modTime time.Time, days int) time.Time {
+	return modTime.UTC().Add(time.Duration(days+1) * 24 * time.Hour).Truncate(24 * time.Hour)
+}
+
+// setLifecycle 在每个视频桶上安装按保留期限过期的生命周期规则。
+// 单桶模式下各路视频保留期限不同时，按视频目录分别设置规则
+func (u *VideoS3Workflow) setLifecycle(ctx context.Context) error {
+	type rule struct {
+		prefix string
+		days   int
+	}
+	rules := make(map[string][]rule)
+	var order []string
+	for _, vc := range u.channels {
+		bucket := vc.Calc_bucket_name()
+		if _, ok := rules[bucket]; !ok {
+			order = append(order, bucket)
+		}
+		prefix := ""
+		if u.SingleRoot {
+			prefix = vc.ChannelName + "/"
+		}
+		rules[bucket] = append(rules[bucket], rule{prefix: prefix, days: lifecycleDays(vc)})
+	}
+	if u.Clock != nil && u.Clock.Speedup != 1 {
+		Logger.Warnf("Stage-Prepare:lifecycle rules expire objects in real time, simulated clock speedup x%v is ignored", u.Clock.Speedup)
+	}
+
+	client, cldone := u.S3Client()
+	defer cldone()
+	installed := make(map[int]int) // 过期天数 -> 规则数
+	for _, bucket := range order {
+		rs := rules[bucket]
+		// 所有视频保留期限相同时，一条规则覆盖整个桶
+		same := true
+		for _, r := range rs {
+			same = same && r.days == rs[0].days
+		}
+		if same {
+			rs = []rule{{days: rs[0].days}}
+		}
+		cfg := lifecycle.NewConfiguration()
+		for i, r := range rs {
+			lr := lifecycle.Rule{
+				ID:         lifecycleRuleID,
+				Status:     "Enabled",
+				RuleFilter: lifecycle.Filter{Prefix: r.prefix},
+				Expiration: lifecycle.Expiration{Days: lifecycle.ExpirationDays(r.days)},
+			}
+			if len(rs) > 1 {
+				lr.ID = fmt.Sprintf("%s-%d", lifecycleRuleID, i)
+			}
+			if u.Versioned {
+				// 多版本桶中过期只生成删除标记，历史版本1天后删除以释放空间
+				lr.NoncurrentVersionExpiration = lifecycle.NoncurrentVersionExpiration{NoncurrentDays: 1}
+			}
+			cfg.Rules = append(cfg.Rules, lr)
+			installed[r.days]++
+		}
+		if err := client.SetBucketLifecycle(ctx, bucket, cfg); err != nil {
+			return fmt.Errorf("set lifecycle on bucket %s: %w", bucket, err)
+		}
+	}
+	days := make([]int, 0, len(installed))
+	for d := range installed {
+		days = append(days, d)
+	}
+	sort.Ints(days)
+	expire := make([]string, 0, len(days))
+	for _, d := range days {
+		expire = append(expire, fmt.Sprintf("%d days (%d rules)", d, installed[d]))
+	}
+	Logger.Infof("Stage-Prepare:lifecycle expiry installed on %d buckets, objects expire after %s", len(order), strings.Join(expire, ", "))
+	return nil
+}
+
+// expirySample 一次过期检查的结果
+type expirySample struct {
+	Time       time.Time
+	Objects    uint64        // 列举到的对象数
+	PastDue    int           // 已到过期时间仍未删除的对象数
+	MaxOverdue time.Duration // 未删除对象超过过期时间的最大时长
+	Expired    int           // 上次检查后按期消失的对象数
+	MaxLag     time.Duration // 本次消失的对象中最大的过期延迟
+	Early      int           // 未到过期时间就消失的对象数
+	Err        string
+}
+
+// expiryChecker 生命周期过期检查：定期列举本次写入的对象，跟踪即将过期的对象，
+// 统计对象实际消失时间相对预期过期时间的延迟，以及已过期仍未删除的对象
+type expiryChecker struct {
+	u        *VideoS3Workflow
+	interval time.Duration
+	days     map[string]int       // 桶名（单桶模式下为视频名）-> 过期天数
+	tracked  map[string]time.Time // bucket/name -> 预期过期时间
+
+	mu       sync.Mutex
+	samples  []expirySample
+	expired  int
+	early    int
+	lagSum   time.Duration
+	lagMax   time.Duration
+	lastDue  int           // 最近一次检查中过期未删除的对象数
+	lastOver time.Duration // 最近一次检查中的最大超期时长
+}
+
+// runExpiry 生命周期过期模式下启动过期检查，返回的函数等待检查协程退出
+func (u *VideoS3Workflow) runExpiry(ctx context.Context) (wait func()) {
+	if u.Retention != video.RetentionLifecycle || u.ExpiryInterval <= 0 {
+		return func() {}
+	}
+	if u.expiry == nil {
+		c := &expiryChecker{u: u, interval: u.ExpiryInterval, days: make(map[string]int), tracked: make(map[string]time.Time)}
+		for _, vc := range u.channels {
+			key := vc.Calc_bucket_name()
+			if u.SingleRoot {
+				key = vc.ChannelName
+			}
+			c.days[key] = lifecycleDays(vc)
+		}
+		u.expiry = c
+	}
+	c := u.expiry
+	Logger.Infof("Stage-Main:lifecycle expiry check every %v", c.interval)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			c.check(ctx)
+		}
+	}()
+	return func() { <-done }
+}
+
+// objectDays 对象所属视频的过期天数
+func (c *expiryChecker) objectDays(bucket, name string) int {
+	key := bucket
+	if c.u.SingleRoot {
+		key = strings.SplitN(name, "/", 2)[0]
+	}
+	if days, ok := c.days[key]; ok {
+		return days
+	}
+	return lifecycleDays(&c.u.VideoWorkflow)
+}
+
+// check 列举本次写入的对象，检查过期情况
+func (c *expiryChecker) check(ctx context.Context) {
+	u := c.u
+	u.prefixesMu.Lock()
+	prefixes := make(map[string][]string, len(u.prefixes))
+	for bucket, pfs := range u.prefixes {
+		for p := range pfs {
+			prefixes[bucket] = append(prefixes[bucket], p)
+		}
+	}
+	u.prefixesMu.Unlock()
+
+	client, cldone := u.S3Client()
+	defer cldone()
+	now := time.Now()
+	s := expirySample{Time: now}
+	seen := make(map[string]struct{})
+	var pastDue string
+	var err error
+list:
+	for bucket, pfs := range prefixes {
+		for _, p := range pfs {
+			for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: p + "/", Recursive: true}) {
+				if obj.Err != nil {
+					err = obj.Err
+					break list
+				}
+				s.Objects++
+				exp := expectedExpiry(obj.LastModified, c.objectDays(bucket, obj.Key))
+				// 只跟踪下次检查前到期的对象
+				if exp.After(now.Add(c.interval)) {
+					continue
+				}
+				key := bucket + "/" + obj.Key
+				c.tracked[key] = exp
+				seen[key] = struct{}{}
+				if overdue := now.Sub(exp); overdue > 0 {
+					s.PastDue++
+					if overdue > s.MaxOverdue {
+						s.MaxOverdue = overdue
+						pastDue = key
+					}
+				}
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		// 列举不完整时无法判断对象是否已删除
+		s.Err = err.Error()
+		u.Error("expiry check list error: ", err)
+	} else {
+		for key, exp := range c.tracked {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			delete(c.tracked, key)
+			// 对象在上次检查后消失，延迟精度为检查间隔
+			lag := now.Sub(exp)
+			if lag < 0 {
+				s.Early++
+				continue
+			}
+			s.Expired++
+			c.lagSum += lag
+			if lag > s.MaxLag {
+				s.MaxLag = lag
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.samples = append(c.samples, s)
+	c.expired += s.Expired
+	c.early += s.Early
+	if s.MaxLag > c.lagMax {
+		c.lagMax = s.MaxLag
+	}
+	c.lastDue, c.lastOver = s.PastDue, s.MaxOverdue
+	c.mu.Unlock()
+
+	if s.PastDue > 0 {
+		Logger.Warnf("Expiry:%d objects past due, max overdue %v, e.g. %s", s.PastDue, s.MaxOverdue.Round(time.Second), pastDue)
+	}
+	if s.Early > 0 {
+		Logger.Warnf("Expiry:%d objects disappeared before their expected expiry", s.Early)
+	}
+}
+
+// writeExpiry 将过期检查结果写入 CSV 文件，并输出汇总
+func (c *expiryChecker) writeExpiry(fileName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.samples) == 0 {
+		return nil
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"time", "objects", "past_due", "max_overdue_ns", "expired", "max_lag_ns", "early", "error"})
+	for _, s := range c.samples {
+		w.Write([]string{
+			s.Time.Format(time.RFC3339Nano),
+			strconv.FormatUint(s.Objects, 10),
+			strconv.Itoa(s.PastDue),
+			strconv.FormatInt(int64(s.MaxOverdue), 10),
+			strconv.Itoa(s.Expired),
+			strconv.FormatInt(int64(s.MaxLag), 10),
+			strconv.Itoa(s.Early),
+			s.Err,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	var avg time.Duration
+	if c.expired > 0 {
+		avg = c.lagSum / time.Duration(c.expired)
+	}
+	Logger.Infof("Expiry:%d checks, %d objects expired by lifecycle, avg lag %v, max lag %v (resolution %v), %d disappeared early, %d past due at last check (max overdue %v), written to %s",
+		len(c.samples), c.expired, avg.Round(time.Second), c.lagMax.Round(time.Second), c.interval,
+		c.early, c.lastDue, c.lastOver.Round(time.Second), fileName)
+	return nil
+}
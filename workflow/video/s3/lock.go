@@ -0,0 +1,198 @@
+package s3worker
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"stress/pkg/bench"
+	. "stress/pkg/logger"
+	"stress/workflow/video"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// opDeleteRefused 删除被对象锁定按预期拒绝，单独统计，不计为失败
+const opDeleteRefused = "DELREFUSED"
+
+// objectLock 对象锁定（WORM）：每个视频对象按保留期限设置 GOVERNANCE/COMPLIANCE 保留，
+// 随机抽取一部分对象设置合法保留（模拟证据视频），统计删除被拒绝的情况
+type objectLock struct {
+	u       *VideoS3Workflow
+	mode    minio.RetentionMode
+	holdPct float64
+	rng     *rand.Rand
+	rngMu   sync.Mutex
+
+	mu      sync.Mutex
+	held    map[string][]string // bucket -> 设置了合法保留的对象，清理前解除
+	refused []refusedDelete     // 删除被拒绝、尚未删除的对象
+
+	locked           int64 // 设置了保留的对象数
+	holds            int64 // 设置了合法保留的对象数
+	refusedHold      int64 // 合法保留导致的删除拒绝
+	refusedRetention int64 // 保留期限未到导致的删除拒绝
+	violations       int64 // 锁定中的对象被成功删除
+}
+
+// newObjectLock 启用对象锁定时返回锁定管理，否则返回 nil
+func (u *VideoS3Workflow) newObjectLock() *objectLock {
+	if u.LockMode == "" && u.LegalHoldPct <= 0 {
+		return nil
+	}
+	l := &objectLock{
+		u:       u,
+		mode:    minio.RetentionMode(u.LockMode),
+		holdPct: u.LegalHoldPct,
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		held:    make(map[string][]string),
+	}
+	Logger.Infof("Object lock:retention mode %q for the data life, legal hold on %.2f%% of objects", u.LockMode, u.LegalHoldPct)
+	return l
+}
+
+// apply 为即将写入的对象设置保留和合法保留，返回是否设置了合法保留
+func (l *objectLock) apply(vc *video.VideoWorkflow, opts *minio.PutObjectOptions) bool {
+	if l == nil {
+		return false
+	}
+	if l.mode != "" {
+		// 保留期限按模拟时钟换算，与客户端按保留期限删除的时间一致
+		opts.Mode = l.mode
+		opts.RetainUntilDate = time.Now().Add(vc.RealDuration(time.Duration(float64(vc.DataLife) * 24 * float64(time.Hour))))
+		// 带保留设置的上传须携带 Content-MD5
+		opts.SendContentMd5 = true
+		atomic.AddInt64(&l.locked, 1)
+	}
+	l.rngMu.Lock()
+	hold := l.rng.Float64()*100 < l.holdPct
+	l.rngMu.Unlock()
+	if hold {
+		opts.LegalHold = minio.LegalHoldEnabled
+		atomic.AddInt64(&l.holds, 1)
+	}
+	return hold
+}
+
+// addHeld 记录设置了合法保留的对象
+func (l *objectLock) addHeld(bucket, name string) {
+	l.mu.Lock()
+	l.held[bucket] = append(l.held[bucket], name)
+	l.mu.Unlock()
+}
+
+// refusedDelete 删除被对象锁定拒绝的对象，保留期限结束后重新删除
+type refusedDelete struct {
+	vc        *video.VideoWorkflow
+	bucket    string
+	name      string
+	versionID string
+	until     time.Time // 保留期限；合法保留的对象为零值，解除前不重新删除
+}
+
+// lockState 从对象元数据判断对象是否处于锁定中，返回锁定原因和保留期限
+func lockState(info minio.ObjectInfo) (string, time.Time) {
+	until, err := time.Parse(time.RFC3339, info.Metadata.Get("X-Amz-Object-Lock-Retain-Until-Date"))
+	if strings.EqualFold(info.Metadata.Get("X-Amz-Object-Lock-Legal-Hold"), string(minio.LegalHoldEnabled)) {
+		return "legal hold", time.Time{}
+	}
+	if err == nil && until.After(time.Now()) {
+		return "retention", until
+	}
+	return "", time.Time{}
+}
+
+// classify 对锁定中对象的删除结果分类：删除被拒绝为预期结果，记录后在保留期限结束时重新删除；
+// 删除成功为 WORM 违规。info 为删除前（或删除失败后）查询的对象信息，未查询时为 nil
+func (l *objectLock) classify(op *bench.Operation, r refusedDelete, info *minio.ObjectInfo, err error) {
+	var locked string
+	if info != nil {
+		locked, r.until = lockState(*info)
+	}
+	switch {
+	case err != nil && locked != "":
+		// 不计为失败
+		op.OpType = opDeleteRefused
+		op.Err, op.ErrClass = "", ""
+		if locked == "legal hold" {
+			atomic.AddInt64(&l.refusedHold, 1)
+		} else {
+			atomic.AddInt64(&l.refusedRetention, 1)
+		}
+		l.mu.Lock()
+		l.refused = append(l.refused, r)
+		l.mu.Unlock()
+	case err != nil:
+		l.u.Error("delete error: ", err)
+	case locked != "":
+		atomic.AddInt64(&l.violations, 1)
+		op.Err = "WORM violation: object under " + locked + " was deleted"
+		l.u.Error(op.File, ": ", op.Err)
+	}
+}
+
+// expired 取出保留期限已结束、可以重新删除的被拒绝对象
+func (l *objectLock) expired(now time.Time) []refusedDelete {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var res []refusedDelete
+	pending := l.refused[:0]
+	for _, r := range l.refused {
+		if !r.until.IsZero() && !r.until.After(now) {
+			res = append(res, r)
+			continue
+		}
+		pending = append(pending, r)
+	}
+	l.refused = pending
+	return res
+}
+
+// release 清理前解除合法保留；COMPLIANCE 模式的对象在保留期限内无法删除
+func (l *objectLock) release(ctx context.Context) {
+	if l == nil {
+		return
+	}
+	client, cldone := l.u.S3Client()
+	defer cldone()
+	off := minio.LegalHoldDisabled
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for bucket, names := range l.held {
+		for _, name := range names {
+			err := client.PutObjectLegalHold(ctx, bucket, name, minio.PutObjectLegalHoldOptions{Status: &off})
+			if err != nil && minio.ToErrorResponse(err).StatusCode != http.StatusNotFound {
+				l.u.Error("release legal hold error: ", err)
+			}
+		}
+	}
+	l.held = make(map[string][]string)
+	if l.mode == minio.Compliance {
+		Logger.Warn("Object lock:objects in COMPLIANCE mode cannot be deleted before their retention expires")
+	}
+}
+
+// report 输出对象锁定统计
+func (l *objectLock) report() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	var pending, held int
+	for _, r := range l.refused {
+		pending++
+		if r.until.IsZero() {
+			held++
+		}
+	}
+	l.mu.Unlock()
+	Logger.Infof("Object lock:%d objects with retention, %d with legal hold; deletes refused: %d by legal hold, %d by retention; %d WORM violations; %d refused objects not yet deleted (%d under legal hold)",
+		atomic.LoadInt64(&l.locked), atomic.LoadInt64(&l.holds),
+		atomic.LoadInt64(&l.refusedHold), atomic.LoadInt64(&l.refusedRetention), atomic.LoadInt64(&l.violations), pending, held)
+}
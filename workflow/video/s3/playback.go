@@ -0,0 +1,262 @@
+package s3worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"stress/pkg/bench"
+	. "stress/pkg/logger"
+	"stress/workflow/video"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// opPlayback 回放读操作类型，每个操作为读取一个视频对象，与写入操作分开统计
+const opPlayback = "PLAYBACK"
+
+const (
+	// playbackPoll 直播回放等待下一个对象写入的轮询间隔
+	playbackPoll = 100 * time.Millisecond
+	// playbackDefaultRange 默认每次范围读取的大小
+	playbackDefaultRange = 1 << 20
+)
+
+// playback 回放读：模拟播放器，随机选择一路视频和一段模拟时间窗口，
+// 按顺序以范围读取的方式逐个读取窗口内的视频对象。
+// 每个对象须在其播放时长内读完，否则视为卡顿
+type playback struct {
+	u       *VideoS3Workflow
+	readers int
+	livePct float64
+	objects int
+	chunk   int64
+	rcv     chan<- bench.Operation
+	rng     *rand.Rand
+	rngMu   sync.Mutex
+	wg      sync.WaitGroup
+
+	sessions int64
+	reads    int64
+	stalls   int64
+	ttfbSum  int64 // 纳秒
+	ttfbMax  int64 // 纳秒
+}
+
+// newPlayback 启动回放读，与写入同时在 wait 关闭后开始，ctx 结束后停止；
+// 回放读线程号排在写入和读回校验之后
+func (u *VideoS3Workflow) newPlayback(ctx context.Context, wait chan struct{}, rcv chan<- bench.Operation) *playback {
+	if u.PlaybackReaders <= 0 {
+		return nil
+	}
+	p := &playback{
+		u:       u,
+		readers: u.PlaybackReaders,
+		livePct: u.PlaybackLivePct,
+		objects: u.PlaybackObjects,
+		chunk:   u.PlaybackRange,
+		rcv:     rcv,
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if p.objects <= 0 {
+		p.objects = 1
+	}
+	if p.chunk <= 0 {
+		p.chunk = playbackDefaultRange
+	}
+	Logger.Infof("Playback:%d readers, %.2f%% live, %d objects per session, range %d bytes", p.readers, p.livePct, p.objects, p.chunk)
+	for i := 0; i < p.readers; i++ {
+		p.wg.Add(1)
+		go func(i int) {
+			defer p.wg.Done()
+			thread := uint16(u.ChannelNum + verifyConcurrent + i)
+			select {
+			case <-ctx.Done():
+				return
+			case <-wait:
+			}
+			for ctx.Err() == nil {
+				p.session(ctx, thread)
+			}
+		}(i)
+	}
+	return p
+}
+
+// wait 等待回放协程退出，并输出回放统计
+func (p *playback) wait() {
+	if p == nil {
+		return
+	}
+	p.wg.Wait()
+	reads := atomic.LoadInt64(&p.reads)
+	if reads == 0 {
+		Logger.Infof("Playback:%d sessions, no object read", atomic.LoadInt64(&p.sessions))
+		return
+	}
+	Logger.Infof("Playback:%d sessions, %d objects, %d stalls (%.2f%%), avg TTFB: %v, max TTFB: %v",
+		atomic.LoadInt64(&p.sessions), reads, atomic.LoadInt64(&p.stalls),
+		100*float64(atomic.LoadInt64(&p.stalls))/float64(reads),
+		time.Duration(atomic.LoadInt64(&p.ttfbSum)/reads).Round(time.Millisecond),
+		time.Duration(atomic.LoadInt64(&p.ttfbMax)).Round(time.Millisecond))
+}
+
+// pick 随机选择一路视频及回放起点：直播回放从最新写入的对象开始，
+// 历史回放从已写入且未删除的对象中随机选择起点
+func (p *playback) pick() (vc *video.VideoWorkflow, idx int, live bool, ok bool) {
+	p.rngMu.Lock()
+	vc = p.u.channels[p.rng.Intn(len(p.u.channels))]
+	live = p.rng.Float64()*100 < p.livePct
+	r := p.rng.Int63()
+	p.rngMu.Unlock()
+
+	p.u.stateMu.Lock()
+	oldest, next := vc.IdxOldest, vc.IdxNext
+	p.u.stateMu.Unlock()
+	if next <= oldest {
+		return vc, 0, live, false
+	}
+	if live {
+		return vc, next - 1, live, true
+	}
+	last := next - p.objects
+	if last < oldest {
+		last = oldest
+	}
+	return vc, oldest + int(r%int64(last-oldest+1)), live, true
+}
+
+// session 一次回放：从起点开始顺序读取 objects 个对象
+func (p *playback) session(ctx context.Context, thread uint16) {
+	vc, start, live, ok := p.pick()
+	if !ok {
+		// 该路视频尚无可读对象
+		select {
+		case <-ctx.Done():
+		case <-time.After(playbackPoll):
+		}
+		return
+	}
+	atomic.AddInt64(&p.sessions, 1)
+	Logger.Debugf("Playback:%s from %s (object %d), live: %v", vc.ChannelName, vc.Calc_time(start).Format(time.RFC3339), start, live)
+
+	// 每个对象的播放时长，与模拟时钟是否加速无关
+	play := time.Duration(float64(vc.TimeInterval) * float64(time.Second))
+	var next time.Time
+	for idx := start; idx < start+p.objects; idx++ {
+		// 播放器只预读一个对象：上一个对象开始播放后才读取下一个
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		p.u.stateMu.Lock()
+		oldest, written := vc.IdxOldest, vc.IdxNext
+		p.u.stateMu.Unlock()
+		if idx < oldest {
+			// 回放过程中对象已过期删除
+			return
+		}
+		for idx >= written {
+			// 直播回放追上写入进度，等待下一个对象写入
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(playbackPoll):
+			}
+			p.u.stateMu.Lock()
+			written = vc.IdxNext
+			p.u.stateMu.Unlock()
+		}
+		op := p.read(ctx, vc, idx, thread, play)
+		if ctx.Err() != nil {
+			return
+		}
+		p.rcv <- op
+		if op.Err != "" {
+			return
+		}
+		next = op.Start.Add(play)
+	}
+}
+
+// read 以范围读取的方式读取一个视频对象，记录首字节时间和读取耗时
+func (p *playback) read(ctx context.Context, vc *video.VideoWorkflow, idx int, thread uint16, play time.Duration) bench.Operation {
+	u := p.u
+	bucket, name := vc.Calc_bucket_name(), vc.Calc_obj_path(idx)
+	client, cldone := u.S3Client()
+	defer cldone()
+	op := bench.Operation{
+		OpType:   opPlayback,
+		Thread:   thread,
+		Channel:  vc.ChannelName,
+		File:     name,
+		ObjPerOp: 1,
+		Endpoint: client.EndpointURL().String(),
+	}
+	op.Start = time.Now()
+	// 须在播放时长内读完，否则播放卡顿
+	due := op.Start.Add(play)
+	op.Due = &due
+	for {
+		n, err := p.readRange(ctx, client, bucket, name, op.Size, &op)
+		op.Size += n
+		if err != nil {
+			// 对象大小恰为范围大小整数倍时，最后一次范围读取越界
+			if minio.ToErrorResponse(err).Code == "InvalidRange" && op.Size > 0 {
+				break
+			}
+			op.Err = fmt.Sprint("playback read error: ", err)
+			u.Error(fmt.Sprintf("%s/%s: %s", bucket, name, op.Err))
+			break
+		}
+		if n < p.chunk {
+			break
+		}
+	}
+	op.End = time.Now()
+	if op.Err == "" {
+		atomic.AddInt64(&p.reads, 1)
+		if op.Lag() > 0 {
+			atomic.AddInt64(&p.stalls, 1)
+		}
+		if op.FirstByte != nil {
+			ttfb := int64(op.FirstByte.Sub(op.Start))
+			atomic.AddInt64(&p.ttfbSum, ttfb)
+			for {
+				cur := atomic.LoadInt64(&p.ttfbMax)
+				if ttfb <= cur || atomic.CompareAndSwapInt64(&p.ttfbMax, cur, ttfb) {
+					break
+				}
+			}
+		}
+	}
+	return op
+}
+
+// readRange 读取对象从 offset 开始的一段，记录整个对象的首字节时间
+func (p *playback) readRange(ctx context.Context, client *minio.Client, bucket, name string, offset int64, op *bench.Operation) (int64, error) {
+	opts := minio.GetObjectOptions{ServerSideEncryption: p.u.PutOpts.ServerSideEncryption}
+	if err := opts.SetRange(offset, offset+p.chunk-1); err != nil {
+		return 0, err
+	}
+	o, err := client.GetObject(ctx, bucket, name, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer o.Close()
+	var buf [1]byte
+	n, err := io.ReadFull(o, buf[:])
+	if err != nil {
+		return int64(n), err
+	}
+	if op.FirstByte == nil {
+		fb := time.Now()
+		op.FirstByte = &fb
+	}
+	rest, err := io.Copy(io.Discard, o)
+	return int64(n) + rest, err
+}
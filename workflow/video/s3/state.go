@@ -0,0 +1,121 @@
+package s3worker
+
+import (
+	"fmt"
+	"os"
+	. "stress/pkg/logger"
+	"stress/workflow/video"
+	"time"
+)
+
+// saveState 保存各路视频运行状态到状态文件
+func (u *VideoS3Workflow) saveState() error {
+	u.stateMu.Lock()
+	cp := video.Checkpoint{
+		Time:     time.Now(),
+		Stage:    u.stage,
+		Channels: make([]video.ChannelState, 0, len(u.channels)),
+	}
+	for _, vc := range u.channels {
+		cp.Channels = append(cp.Channels, vc.State())
+	}
+	u.stateMu.Unlock()
+	return video.SaveCheckpoint(u.StateFile, &cp)
+}
+
+// SaveState 保存运行状态，运行被中断时调用，之后可通过 resume 继续运行
+func (u *VideoS3Workflow) SaveState() error {
+	if u.StateFile == "" {
+		return nil
+	}
+	return u.saveState()
+}
+
+// restoreState 从状态文件恢复各路视频运行状态
+func (u *VideoS3Workflow) restoreState() error {
+	cp, err := video.LoadCheckpoint(u.StateFile)
+	if err != nil {
+		return err
+	}
+	if len(cp.Channels) != len(u.channels) {
+		return fmt.Errorf("state file %s has %d channels, want %d", u.StateFile, len(cp.Channels), len(u.channels))
+	}
+	for i, st := range cp.Channels {
+		if st.ChannelID != u.channels[i].ChannelID {
+			return fmt.Errorf("state file %s: unexpected channel %d at position %d", u.StateFile, st.ChannelID, i)
+		}
+		if err := u.channels[i].Restore(st); err != nil {
+			return fmt.Errorf("state file %s: %w", u.StateFile, err)
+		}
+	}
+	u.stage = cp.Stage
+	Logger.Infof("Resume from state file %s, stage: %s, saved at %s", u.StateFile, cp.Stage, cp.Time.Format(time.RFC3339))
+	return nil
+}
+
+// runCheckpoint 进入 stage 阶段，并每隔 StateInterval 保存一次状态文件。
+// 返回的函数停止定期保存，并保存最终状态
+func (u *VideoS3Workflow) runCheckpoint(stage string) (stop func()) {
+	u.stateMu.Lock()
+	u.stage = stage
+	u.stateMu.Unlock()
+	if u.StateFile == "" || u.StateInterval <= 0 {
+		return func() {}
+	}
+	save := func() {
+		if err := u.saveState(); err != nil {
+			u.Error("save state error: ", err)
+		}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(u.StateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				save()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		save()
+	}
+}
+
+// written 一路视频第 idx 个对象写入结束
+func (u *VideoS3Workflow) written(vc *video.VideoWorkflow, idx int) {
+	u.stateMu.Lock()
+	vc.Written(idx)
+	u.stateMu.Unlock()
+}
+
+// nextDelete 一路视频需要删除的最早对象序号
+func (u *VideoS3Workflow) nextDelete(vc *video.VideoWorkflow) (int, bool) {
+	u.stateMu.Lock()
+	defer u.stateMu.Unlock()
+	return vc.NextDelete()
+}
+
+// deleted 一路视频删除完成第 idx 个对象
+func (u *VideoS3Workflow) deleted(vc *video.VideoWorkflow, idx int) {
+	u.stateMu.Lock()
+	vc.Deleted(idx)
+	u.stateMu.Unlock()
+}
+
+// removeState 数据清理后，状态文件不再有效
+func (u *VideoS3Workflow) removeState() {
+	if u.StateFile == "" {
+		return
+	}
+	if err := os.Remove(u.StateFile); err != nil && !os.IsNotExist(err) {
+		u.Error("remove state file error: ", err)
+	}
+}
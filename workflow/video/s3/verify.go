@@ -0,0 +1,229 @@
+package s3worker
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"stress/pkg/bench"
+	"stress/pkg/generator"
+	. "stress/pkg/logger"
+	"stress/workflow/video"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// opVerify 读回校验操作类型，校验不一致时记录为失败操作
+const opVerify = "VERIFY"
+
+const (
+	// verifyConcurrent 读回校验并行数
+	verifyConcurrent = 4
+	// verifyQueueSize 待校验队列长度，队列满时放弃本次抽样，不影响写入节奏
+	verifyQueueSize = 10000
+)
+
+// plainETag 非多段上传、非加密对象的 ETag 即为内容 MD5
+var plainETag = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// verifyJob 一个待校验的视频对象
+type verifyJob struct {
+	vc      *video.VideoWorkflow
+	idx     int
+	bucket  string
+	name    string
+	size    int64
+	md5     string
+	etag    string
+	due     time.Time
+	delayed bool // 是否为延迟后的第二次校验
+}
+
+// verifier 读回校验：按比例抽样已写入的视频对象，写入后立即、以及延迟一段时间后
+// 各读回一次，校验大小、MD5 以及 ETag（ETag 为 MD5 时）
+type verifier struct {
+	u       *VideoS3Workflow
+	pct     float64
+	delay   time.Duration
+	jobs    chan verifyJob
+	delayed chan verifyJob
+	rcv     chan<- bench.Operation
+	rng     *rand.Rand
+	rngMu   sync.Mutex
+	wg      sync.WaitGroup
+}
+
+// newVerifier 启动读回校验，ctx 结束后停止
+func (u *VideoS3Workflow) newVerifier(ctx context.Context, rcv chan<- bench.Operation) *verifier {
+	if u.VerifyPct <= 0 {
+		return nil
+	}
+	v := &verifier{
+		u:       u,
+		pct:     u.VerifyPct,
+		delay:   u.VerifyDelay,
+		jobs:    make(chan verifyJob, verifyQueueSize),
+		delayed: make(chan verifyJob, verifyQueueSize),
+		rcv:     rcv,
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	Logger.Infof("Verify:%.2f%% of objects, again after %v", v.pct, v.delay)
+	for i := 0; i < verifyConcurrent; i++ {
+		v.wg.Add(1)
+		go func(i int) {
+			defer v.wg.Done()
+			thread := uint16(u.ChannelNum + i)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-v.jobs:
+					v.check(job, thread)
+				}
+			}
+		}(i)
+	}
+	if v.delay > 0 {
+		v.wg.Add(1)
+		go func() {
+			defer v.wg.Done()
+			for {
+				var job verifyJob
+				select {
+				case <-ctx.Done():
+					return
+				case job = <-v.delayed:
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Until(job.due)):
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case v.jobs <- job:
+				}
+			}
+		}()
+	}
+	return v
+}
+
+// wait 等待校验协程退出
+func (v *verifier) wait() {
+	if v == nil {
+		return
+	}
+	v.wg.Wait()
+}
+
+// sample 决定是否抽样校验即将写入的对象
+func (v *verifier) sample() bool {
+	if v == nil {
+		return false
+	}
+	v.rngMu.Lock()
+	defer v.rngMu.Unlock()
+	return v.rng.Float64()*100 < v.pct
+}
+
+// add 对象写入成功后加入待校验队列
+func (v *verifier) add(job verifyJob) {
+	select {
+	case v.jobs <- job:
+	default:
+		Logger.Warnf("Verify:queue full, skip %s/%s", job.bucket, job.name)
+	}
+}
+
+// objectMd5 计算待上传对象内容的 MD5，并将 Reader 复位；
+// 上传真实文件时直接使用预先计算的文件 MD5
+func objectMd5(obj *generator.Object) (string, error) {
+	if obj.Md5 != "" {
+		return obj.Md5, nil
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, obj.Reader); err != nil {
+		return "", err
+	}
+	if _, err := obj.Reader.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// check 读回对象并校验
+func (v *verifier) check(job verifyJob, thread uint16) {
+	u := v.u
+	// 对象已被边写边删流程删除，无需校验
+	u.stateMu.Lock()
+	deleted := job.idx < job.vc.IdxOldest
+	u.stateMu.Unlock()
+	if deleted {
+		return
+	}
+
+	client, cldone := u.S3Client()
+	defer cldone()
+	op := bench.Operation{
+		OpType:   opVerify,
+		Thread:   thread,
+		Channel:  job.vc.ChannelName,
+		File:     job.name,
+		ObjPerOp: 1,
+		Endpoint: client.EndpointURL().String(),
+	}
+	op.Start = time.Now()
+	size, sum, etag, err := readObjectMd5(u.RequestContext(), client, job.bucket, job.name, u.PutOpts)
+	op.End = time.Now()
+	op.Size = size
+	switch {
+	case err != nil:
+		op.Err = fmt.Sprint("verify read error: ", err)
+	case size != job.size:
+		op.Err = fmt.Sprintf("verify size mismatch: want %d, got %d", job.size, size)
+	case sum != job.md5:
+		op.Err = fmt.Sprintf("verify md5 mismatch: want %s, got %s", job.md5, sum)
+	case plainETag.MatchString(job.etag) && etag != job.etag:
+		op.Err = fmt.Sprintf("verify etag mismatch: want %s, got %s", job.etag, etag)
+	}
+	if op.Err != "" {
+		u.Error(fmt.Sprintf("%s/%s: %s", job.bucket, job.name, op.Err))
+	}
+	v.rcv <- op
+
+	if !job.delayed && v.delay > 0 {
+		job.delayed = true
+		job.due = time.Now().Add(v.delay)
+		select {
+		case v.delayed <- job:
+		default:
+			Logger.Warnf("Verify:delayed queue full, skip %s/%s", job.bucket, job.name)
+		}
+	}
+}
+
+// readObjectMd5 读取对象，返回实际大小、内容 MD5 及 ETag
+func readObjectMd5(ctx context.Context, client *minio.Client, bucket, name string, putOpts minio.PutObjectOptions) (int64, string, string, error) {
+	o, err := client.GetObject(ctx, bucket, name, minio.GetObjectOptions{ServerSideEncryption: putOpts.ServerSideEncryption})
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer o.Close()
+	h := md5.New()
+	n, err := io.Copy(h, o)
+	if err != nil {
+		return n, "", "", err
+	}
+	info, err := o.Stat()
+	if err != nil {
+		return n, "", "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), info.ETag, nil
+}
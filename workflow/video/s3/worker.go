@@ -4,16 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"stress/pkg/bench"
+	"stress/pkg/generator"
 	. "stress/pkg/logger"
 	"stress/workflow"
 	"stress/workflow/video"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/minio/madmin-go/v2"
 	"github.com/minio/minio-go/v7"
-	"github.com/minio/pkg/console"
 )
 
 // Put benchmarks upload speed.
@@ -21,151 +25,596 @@ type VideoS3Workflow struct {
 	workflow.Common
 	video.VideoWorkflow
 	// S3Client func() (cl *minio.Client, done func())
-	prefixes map[string]struct{}
+	prefixes   map[string]map[string]struct{} // bucket -> 顶层目录
+	prefixesMu sync.Mutex
+	channels   []*video.VideoWorkflow // 各路视频运行状态
+	stage      string                 // 当前运行阶段，记录在状态文件中
+	stateMu    sync.Mutex             // 保护 channels 运行状态的更新
+	verify     *verifier              // 读回校验，仅在边写边删阶段启用
+	capacity   *capacityMonitor       // 容量水位监控
+	playback   *playback              // 回放读，仅在边写边删阶段启用
+	pool       *video.Pool            // 边写边删阶段的写入调度
+	expiry     *expiryChecker         // 生命周期过期检查
+	lock       *objectLock            // 对象锁定（WORM）
+
+	AdminClient  *madmin.AdminClient       // 统计集群已用容量
+	GroupSources []func() generator.Source // 多组视频场景下各组的数据源，为空时使用 Source
 }
 
-// CreateEmptyBucket will create an empty bucket
-// or delete all content if it already exists.
-func (u *VideoS3Workflow) CreateEmptyBucket(ctx context.Context) error {
-	cl, done := u.S3Client()
-	defer done()
-	x, err := cl.BucketExists(ctx, u.Bucket)
-	if err != nil {
-		return err
+// prepareBucketConcurrent 创建桶阶段的并行数
+const prepareBucketConcurrent = 16
+
+// bucketCommon 返回指定桶的 Common 参数副本
+func (u *VideoS3Workflow) bucketCommon(bucket string) *workflow.Common {
+	c := u.Common
+	c.Bucket = bucket
+	return &c
+}
+
+// buckets 返回所有视频使用的桶名
+func (u *VideoS3Workflow) buckets() []string {
+	var buckets []string
+	seen := make(map[string]struct{}, u.BucketNum)
+	for _, vc := range u.channels {
+		bucket := vc.Calc_bucket_name()
+		if _, ok := seen[bucket]; ok {
+			continue
+		}
+		seen[bucket] = struct{}{}
+		buckets = append(buckets, bucket)
 	}
+	return buckets
+}
 
-	if x && u.Locking {
-		_, _, _, err := cl.GetBucketObjectLockConfig(ctx, u.Bucket)
-		if err != nil {
-			if !u.Clear {
-				return errors.New("not allowed to clear bucket to re-create bucket with locking")
-			}
-			if bvc, err := cl.GetBucketVersioning(ctx, u.Bucket); err == nil {
-				u.Versioned = bvc.Status == "Enabled"
-			}
-			console.Eraseline()
-			console.Infof("\rClearing Bucket %q to enable locking...", u.Bucket)
-			u.DeleteAllInBucket(ctx)
-			err = cl.RemoveBucket(ctx, u.Bucket)
-			if err != nil {
-				return err
-			}
-			// Recreate bucket.
-			x = false
+// Prepare will create an empty buckets ot delete any content already there.
+func (u *VideoS3Workflow) Prepare(ctx context.Context) error {
+	u.channels = u.newChannels()
+	u.lock = u.newObjectLock()
+	buckets := u.buckets()
+	if u.Resume {
+		// 断点续跑：桶和数据已存在，不重新创建
+		u.checkVersioning(ctx, buckets)
+		return u.restoreState()
+	}
+	if u.SkipStageInit {
+		Logger.Infof("Stage-Prepare:skipped, %d buckets", len(buckets))
+		u.checkVersioning(ctx, buckets)
+		if u.Retention == video.RetentionLifecycle {
+			return u.setLifecycle(ctx)
 		}
+		return nil
+	}
+	if u.SingleRoot {
+		Logger.Infof("Stage-Prepare:Create empty bucket: %s", u.SingleRootName)
+	} else {
+		Logger.Infof("Stage-Prepare:Create empty buckets: %s%d~%d", u.BucketPrefix, 0, len(buckets)-1)
 	}
 
-	if !x {
-		console.Eraseline()
-		console.Infof("\rCreating Bucket %q...", u.Bucket)
-		err := cl.MakeBucket(ctx, u.Bucket, minio.MakeBucketOptions{
-			Region:        u.Location,
-			ObjectLocking: u.Locking,
-		})
-		// In client mode someone else may have created it first.
-		// Check if it exists now.
-		// We don't test against a specific error since we might run against many different servers.
-		if err != nil {
-			x, err2 := cl.BucketExists(ctx, u.Bucket)
-			if err2 != nil {
-				return err2
-			}
-			if !x {
-				// It still doesn't exits, return original error.
-				return err
+	bucketCh := make(chan string, len(buckets))
+	for _, bucket := range buckets {
+		bucketCh <- bucket
+	}
+	close(bucketCh)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var groupErr error
+	var finished int
+	for i := 0; i < prepareBucketConcurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for bucket := range bucketCh {
+				bc := u.bucketCommon(bucket)
+				err := bc.CreateEmptyBucket(ctx)
+				mu.Lock()
+				finished++
+				if err != nil && groupErr == nil {
+					groupErr = fmt.Errorf("create bucket %s: %w", bucket, err)
+				}
+				// 任意一个桶开启了多版本，删除时都需要指定版本
+				u.Versioned = u.Versioned || bc.Versioned
+				u.UpdatePrepareProgress(float64(finished) / float64(len(buckets)))
+				mu.Unlock()
 			}
-		}
+		}()
 	}
-	if bvc, err := cl.GetBucketVersioning(ctx, u.Bucket); err == nil {
-		u.Versioned = bvc.Status == "Enabled"
+	wg.Wait()
+	if groupErr == nil && u.Retention == video.RetentionLifecycle {
+		groupErr = u.setLifecycle(ctx)
 	}
+	return groupErr
+}
 
-	if u.Clear {
-		console.Eraseline()
-		console.Infof("\rClearing Bucket %q...", u.Bucket)
-		u.DeleteAllInBucket(ctx)
+// checkVersioning 桶已存在、未经创建流程时，检查各桶是否开启了多版本（对象锁定的桶总是开启），
+// 任意一个桶开启了多版本，删除时都需要指定版本
+func (u *VideoS3Workflow) checkVersioning(ctx context.Context, buckets []string) {
+	client, cldone := u.S3Client()
+	defer cldone()
+	for _, bucket := range buckets {
+		if bvc, err := client.GetBucketVersioning(ctx, bucket); err == nil && bvc.Status == "Enabled" {
+			u.Versioned = true
+			return
+		}
 	}
-	return nil
 }
 
-// Prepare will create an empty buckets ot delete any content already there.
-func (u *VideoS3Workflow) Prepare(ctx context.Context) error {
-	Logger.Infof("Stage-Prepare:Create empty buckets: %s%d~%d", u.BucketPrefix, 0, u.BucketNum)
-	return nil // u.CreateEmptyBucket(ctx)
+// newChannels 初始化各路视频
+func (u *VideoS3Workflow) newChannels() []*video.VideoWorkflow {
+	return u.NewChannels()
+}
+
+// newSource 返回一路视频使用的数据源：多组视频场景下各组对象大小不同，使用各自的数据源
+func (u *VideoS3Workflow) newSource(vc *video.VideoWorkflow) generator.Source {
+	if vc.GroupIdx < len(u.GroupSources) && u.GroupSources[vc.GroupIdx] != nil {
+		return u.GroupSources[vc.GroupIdx]()
+	}
+	return u.Source()
+}
+
+// Prefill 数据预埋阶段：PrepareChannelNum 路并行写入、总速率 PrepareConcurrent 个对象/秒，
+// 将每路视频写满 ObjNumPC 个对象（安全水位），之后由 Start 进入边写边删阶段
+func (u *VideoS3Workflow) Prefill(ctx context.Context) (bench.Operations, error) {
+	if u.channels == nil {
+		u.channels = u.newChannels()
+	}
+	c := u.NewCollector()
+	if u.SkipStagePrefill || u.DeleteImmediately || u.stage == video.StageMain {
+		Logger.Info("Stage-Prefill:skipped")
+		return c.Close(), nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	waitCapacity := u.runCapacity(ctx, "Prefill")
+	// 断点续跑时，只写入每路视频剩余的对象
+	total := 0
+	for _, vc := range u.channels {
+		if n := vc.ObjNumPC - (vc.IdxNext - vc.IdxOldest); n > 0 {
+			total += n
+		}
+	}
+	if total == 0 {
+		Logger.Info("Stage-Prefill:skipped, no objects to prefill")
+		return c.Close(), nil
+	}
+	stop := u.runCheckpoint(video.StagePrefill)
+	defer stop()
+	Logger.Infof("Stage-Prefill:%d objects, %d workers, %.3f objects/s", total, u.PrepareChannelNum, u.PrepareConcurrent)
+
+	type prefillJob struct {
+		vc  *video.VideoWorkflow
+		idx int
+	}
+	jobs := make(chan prefillJob)
+	go func() {
+		defer close(jobs)
+		var tick <-chan time.Time
+		if u.PrepareConcurrent > 0 {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / float64(u.PrepareConcurrent)))
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		// 各路视频下一个待下发的对象序号；IdxNext 只在对象写入结束后推进
+		next := make(map[*video.VideoWorkflow]int, len(u.channels))
+		for _, vc := range u.channels {
+			next[vc] = vc.IdxNext
+		}
+		// 各路视频轮流写入，保证每路视频对象序号连续
+		for pending := true; pending; {
+			pending = false
+			for _, vc := range u.channels {
+				if next[vc]-vc.IdxOldest >= vc.ObjNumPC {
+					continue
+				}
+				pending = true
+				// 超过安全水位时暂停预埋
+				u.capacity.waitBelow(ctx)
+				if tick != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-tick:
+					}
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case jobs <- prefillJob{vc: vc, idx: next[vc]}:
+				}
+				next[vc]++
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	var finished int64
+	wg.Add(u.PrepareChannelNum)
+	for i := 0; i < u.PrepareChannelNum; i++ {
+		go func(i int) {
+			rcv := c.Receiver()
+			defer wg.Done()
+			srcs := make(map[int]generator.Source)
+			for job := range jobs {
+				src, ok := srcs[job.vc.GroupIdx]
+				if !ok {
+					src = u.newSource(job.vc)
+					srcs[job.vc.GroupIdx] = src
+				}
+				op := u.putObject(job.vc, src, job.idx, 0, uint16(i))
+				rcv <- op
+				// 写入结束后才记录进度，状态文件不会包含未上传的对象；中断时被中止的写入不记录
+				if op.ErrClass != bench.ErrClassCanceled {
+					u.written(job.vc, job.idx)
+				}
+				u.UpdatePrepareProgress(float64(atomic.AddInt64(&finished, 1)) / float64(total))
+			}
+		}(i)
+	}
+	wg.Wait()
+	cancel()
+	waitCapacity()
+	return c.Close(), nil
 }
 
 // Start will execute the main workflow.
 // Operations should begin executing when the start channel is closed.
+// 每路视频独立运行，按 TimeInterval 节奏产生一个视频对象，对象名由 Calc_obj_path 计算得出
 func (u *VideoS3Workflow) Start(ctx context.Context, wait chan struct{}) (bench.Operations, error) {
 	var wg sync.WaitGroup
-	wg.Add(u.Concurrency)
-	c := bench.NewCollector()
+	c := u.NewCollector()
 	if u.AutoTermDur > 0 {
 		ctx = c.AutoTerm(ctx, http.MethodPut, u.AutoTermScale, bench.AutoTermCheck, bench.AutoTermSamples, u.AutoTermDur)
 	}
-	u.prefixes = make(map[string]struct{}, u.Concurrency)
+	if u.channels == nil {
+		u.channels = u.newChannels()
+	}
+	stop := u.runCheckpoint(video.StageMain)
+	defer stop()
+	u.verify = u.newVerifier(ctx, c.Receiver())
+	waitCapacity := u.runCapacity(ctx, "Main")
+	waitExpiry := u.runExpiry(ctx)
+	if u.Clock != nil {
+		// 模拟时钟从各路视频中最早待写入对象的时间开始
+		first := u.channels[0]
+		for _, vc := range u.channels {
+			if vc.Calc_time(vc.IdxNext).Before(first.Calc_time(first.IdxNext)) {
+				first = vc
+			}
+		}
+		u.Clock.Begin(first.Calc_time(first.IdxNext))
+		Logger.Infof("Stage-Main:simulated clock from %s, speedup x%v", u.Clock.Now().Format(time.RFC3339), u.Clock.Speedup)
+	}
+	if len(u.Groups) == 0 {
+		Logger.Infof("Stage-Main:%d channels, one object every %v per channel", u.ChannelNum, u.ObjInterval())
+	}
+	for i, vc := range u.channels {
+		// 每组视频的第一路
+		if len(u.Groups) > 0 && (i == 0 || vc.GroupIdx != u.channels[i-1].GroupIdx) {
+			Logger.Infof("Stage-Main:group %s, %d channels, one object every %v per channel", vc.GroupName, vc.ChannelNum, vc.ObjInterval())
+		}
+	}
+	u.playback = u.newPlayback(ctx, wait, c.Receiver())
 
-	// Non-terminating context.
-	nonTerm := context.Background()
+	u.stateMu.Lock()
+	u.pool = video.NewPool(u.Concurrency)
+	u.stateMu.Unlock()
+	go u.pool.Monitor(ctx, backlogInterval)
+	Logger.Infof("Stage-Main:up to %d workers per channel, %d concurrent uploads in total (0 = unlimited)", u.MaxWorkers, u.Concurrency)
 
-	for i := 0; i < u.Concurrency; i++ {
-		src := u.Source()
-		u.prefixes[src.Prefix()] = struct{}{}
-		go func(i int) {
-			rcv := c.Receiver()
+	wg.Add(len(u.channels))
+	for i, vc := range u.channels {
+		// 每组视频按各自码流和对象大小计算节奏；追加写模式下，每个分片产生时间间隔写入一个分片
+		interval := vc.ObjInterval()
+		segments := 1
+		if vc.Appendable && vc.Segments > 1 {
+			segments = vc.Segments
+		}
+		step := interval / time.Duration(segments)
+		// 各路视频的起始时间在一个对象周期内错开，避免所有视频同一时刻写入
+		offset := interval * time.Duration(i) / time.Duration(len(u.channels))
+		w := u.newChannelWriter(ctx, vc, uint16(i), c.Receiver())
+		go func(i int, vc *video.VideoWorkflow, w *channelWriter, step time.Duration) {
 			defer wg.Done()
-			opts := u.PutOpts
+			defer w.close()
 			done := ctx.Done()
+			// 启用事件模型时，对象产生间隔和大小随事件变化
+			events := vc.NewEventTimeline(time.Now().UnixNano() + int64(i))
+			var size int64
+			// 下一个待产生的对象序号；写入由处理协程完成，可能滞后于产生
+			idx := vc.IdxNext
+			var app *appendUpload
+			var ready chan struct{}
 
 			<-wait
-			for {
+			next := time.Now().Add(offset)
+			timer := time.NewTimer(0)
+			defer timer.Stop()
+			for n := 0; ; n++ {
+				if events != nil && n%segments == 0 {
+					// 仅事件录像时，非追加写模式下事件结束即写入不足一个对象大小的数据
+					var d time.Duration
+					d, size = events.Next(int64(vc.FileInfo.Size), !vc.Appendable)
+					step = vc.RealDuration(d) / time.Duration(segments)
+				}
+				// 第 n 个对象（分片）产生的时间，按码流产生后排队等待写入
+				due := next
+				next = due.Add(step)
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(time.Until(due))
 				select {
 				case <-done:
 					return
-				default:
-				}
-				obj := src.Object()
-				opts.ContentType = obj.ContentType
-				client, cldone := u.S3Client()
-				op := bench.Operation{
-					OpType:   http.MethodPut,
-					Thread:   uint16(i),
-					Size:     obj.Size,
-					File:     obj.Name,
-					ObjPerOp: 1,
-					Endpoint: client.EndpointURL().String(),
+				case <-timer.C:
 				}
-				op.Start = time.Now()
-				res, err := client.PutObject(nonTerm, u.Bucket, obj.Name, obj.Reader, obj.Size, opts)
-				op.End = time.Now()
-				if err != nil {
-					u.Error("upload error: ", err)
-					op.Err = err.Error()
+				// 超过安全水位时跳过当前对象（的所有分片）
+				if n%segments == 0 && u.capacity.skip() {
+					n += segments - 1
+					next = next.Add(step * time.Duration(segments-1))
+					continue
 				}
-				obj.VersionID = res.VersionID
-
-				if res.Size != obj.Size && op.Err == "" {
-					err := fmt.Sprint("short upload. want:", obj.Size, ", got:", res.Size)
-					if op.Err == "" {
-						op.Err = err
+				// 当前对象（分片）须在下一个对象（分片）产生前写完，否则视为延误
+				opDue := next
+				if vc.Appendable {
+					seg := n % segments
+					if seg == 0 {
+						app = w.newAppend(idx)
+						idx++
+						ready = nil
+					}
+					// 同一对象的分片按顺序写入：前一个分片写完后才开始下一个
+					prev := ready
+					ready = make(chan struct{})
+					if !w.submitSegment(app, seg, segments, opDue, prev, ready) {
+						return
 					}
-					u.Error(err)
+				} else {
+					if !w.submitPut(idx, size, opDue) {
+						return
+					}
+					idx++
 				}
-				op.Size = res.Size
-				cldone()
-				rcv <- op
 			}
-		}(i)
+		}(i, vc, w, step)
 	}
 	wg.Wait()
+	u.verify.wait()
+	u.playback.wait()
+	waitCapacity()
+	waitExpiry()
 	return c.Close(), nil
 }
 
-// Cleanup deletes everything uploaded to the bucket.
+// putObject 上传一路视频的第 idx 个对象，size 大于0时只上传对象的前 size 字节
+func (u *VideoS3Workflow) putObject(vc *video.VideoWorkflow, src generator.Source, idx int, size int64, thread uint16) bench.Operation {
+	// Non-terminating context, only canceled if the operation does not finish in time after an interrupt.
+	nonTerm := u.RequestContext()
+
+	obj := src.Object()
+	if size > 0 && size < obj.Size {
+		truncateObject(obj, size)
+	}
+	obj.Name = vc.Calc_obj_path(idx)
+	opts := u.PutOpts
+	opts.ContentType = obj.ContentType
+	hold := u.lock.apply(vc, &opts)
+	bucket := vc.Calc_bucket_name()
+	u.addPrefix(bucket, obj.Name)
+	var sum string
+	if u.verify.sample() {
+		var err error
+		if sum, err = objectMd5(obj); err != nil {
+			u.Error("verify md5 error: ", err)
+		}
+	}
+
+	client, cldone := u.S3Client()
+	defer cldone()
+	op := bench.Operation{
+		OpType:   http.MethodPut,
+		Thread:   thread,
+		Channel:  vc.ChannelName,
+		Size:     obj.Size,
+		File:     obj.Name,
+		ObjPerOp: 1,
+		Endpoint: client.EndpointURL().String(),
+	}
+	op.Start = time.Now()
+	var res minio.UploadInfo
+	attempts, err, last := u.RetryPolicy(op.OpType).Do(nonTerm, func() error {
+		// 重试时从头上传
+		if _, err := obj.Reader.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		var err error
+		res, err = client.PutObject(nonTerm, bucket, obj.Name, obj.Reader, obj.Size, opts)
+		return err
+	})
+	op.End = time.Now()
+	op.Record(attempts, err, last)
+	if err != nil {
+		u.Error("upload error: ", err)
+	}
+	obj.VersionID = res.VersionID
+
+	if res.Size != obj.Size && op.Err == "" {
+		err := fmt.Sprint("short upload. want:", obj.Size, ", got:", res.Size)
+		op.Err, op.ErrClass = err, bench.ErrClassOther
+		u.Error(err)
+	}
+	op.Size = res.Size
+	if hold && op.Err == "" {
+		u.lock.addHeld(bucket, obj.Name)
+	}
+	if sum != "" && op.Err == "" {
+		u.verify.add(verifyJob{vc: vc, idx: idx, bucket: bucket, name: obj.Name, size: obj.Size, md5: sum, etag: res.ETag})
+	}
+	return op
+}
+
+// truncateObject 只保留对象的前 size 字节，用于事件结束时写入不足一个对象大小的数据
+func truncateObject(obj *generator.Object, size int64) {
+	obj.Reader = &truncatedReader{r: obj.Reader, n: size}
+	obj.Size = size
+	// 源文件的 MD5 不再适用
+	obj.Md5 = ""
+}
+
+// truncatedReader 只读取前 n 字节的 ReadSeeker
+type truncatedReader struct {
+	r   io.ReadSeeker
+	n   int64
+	off int64
+}
+
+func (t *truncatedReader) Read(p []byte) (int, error) {
+	if t.off >= t.n {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > t.n-t.off {
+		p = p[:t.n-t.off]
+	}
+	n, err := t.r.Read(p)
+	t.off += int64(n)
+	return n, err
+}
+
+func (t *truncatedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += t.off
+	case io.SeekEnd:
+		offset += t.n
+	default:
+		return 0, errors.New("truncatedReader.Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("truncatedReader.Seek: negative position")
+	}
+	if _, err := t.r.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	t.off = offset
+	return offset, nil
+}
+
+// deleteObject 删除一路视频的第 idx 个对象
+func (u *VideoS3Workflow) deleteObject(vc *video.VideoWorkflow, idx int, thread uint16) bench.Operation {
+	return u.removeObject(vc, vc.Calc_bucket_name(), vc.Calc_obj_path(idx), "", thread)
+}
+
+// removeObject 删除一路视频的一个对象，versionID 为空时在多版本桶中查询当前版本
+func (u *VideoS3Workflow) removeObject(vc *video.VideoWorkflow, bucket, name, versionID string, thread uint16) bench.Operation {
+	// Non-terminating context, only canceled if the operation does not finish in time after an interrupt.
+	nonTerm := u.RequestContext()
+
+	client, cldone := u.S3Client()
+	defer cldone()
+	op := bench.Operation{
+		OpType:   http.MethodDelete,
+		Thread:   thread,
+		Channel:  vc.ChannelName,
+		Size:     0,
+		File:     name,
+		ObjPerOp: 1,
+		Endpoint: client.EndpointURL().String(),
+	}
+	op.Start = time.Now()
+	opts := minio.RemoveObjectOptions{VersionID: versionID}
+	var info *minio.ObjectInfo
+	if u.Versioned && versionID == "" {
+		// 多版本桶中需指定版本删除，否则只会生成删除标记，不释放空间
+		if st, err := client.StatObject(nonTerm, bucket, name, minio.StatObjectOptions{}); err == nil {
+			opts.VersionID = st.VersionID
+			info = &st
+		}
+	}
+	attempts, err, last := u.RetryPolicy(op.OpType).Do(nonTerm, func() error {
+		return client.RemoveObject(nonTerm, bucket, name, opts)
+	})
+	op.End = time.Now()
+	op.Record(attempts, err, last)
+	if u.lock == nil {
+		if err != nil {
+			u.Error("delete error: ", err)
+		}
+		return op
+	}
+	if err != nil && info == nil {
+		// 删除失败时才查询对象是否处于锁定中
+		if st, serr := client.StatObject(nonTerm, bucket, name, minio.StatObjectOptions{VersionID: opts.VersionID}); serr == nil {
+			info = &st
+		}
+	}
+	u.lock.classify(&op, refusedDelete{vc: vc, bucket: bucket, name: name, versionID: opts.VersionID}, info, err)
+	return op
+}
+
+// addPrefix 记录每个桶中写入过的顶层目录，用于 Cleanup
+func (u *VideoS3Workflow) addPrefix(bucket, name string) {
+	prefix := strings.SplitN(name, "/", 2)[0]
+	u.prefixesMu.Lock()
+	defer u.prefixesMu.Unlock()
+	if u.prefixes == nil {
+		u.prefixes = make(map[string]map[string]struct{})
+	}
+	if u.prefixes[bucket] == nil {
+		u.prefixes[bucket] = make(map[string]struct{})
+	}
+	u.prefixes[bucket][prefix] = struct{}{}
+}
+
+// Cleanup deletes everything uploaded to the buckets.
 func (u *VideoS3Workflow) Cleanup(ctx context.Context) {
-	var pf []string
-	for p := range u.prefixes {
-		pf = append(pf, p)
+	u.lock.release(ctx)
+	for bucket, prefixes := range u.prefixes {
+		var pf []string
+		for p := range prefixes {
+			pf = append(pf, p)
+		}
+		u.bucketCommon(bucket).DeleteAllInBucket(ctx, pf...)
+	}
+	u.removeState()
+}
+
+// PeriodStatus 永久运行时周期报告中的视频状态：写入积压和最近一次容量采样
+func (u *VideoS3Workflow) PeriodStatus() string {
+	u.stateMu.Lock()
+	pool, capacity := u.pool, u.capacity
+	u.stateMu.Unlock()
+	var status []string
+	if pool != nil {
+		total, channels, _ := pool.Backlog()
+		status = append(status, fmt.Sprintf("backlog %d tasks in %d channels", total, channels))
+	}
+	if capacity != nil {
+		if s := capacity.status(); s != "" {
+			status = append(status, s)
+		}
+	}
+	return strings.Join(status, "; ")
+}
+
+// Report 写入操作记录以外的运行结果：对象锁定统计、写入积压、生命周期过期检查、容量曲线
+func (u *VideoS3Workflow) Report(fileName string) error {
+	u.lock.report()
+	if u.pool != nil {
+		if err := u.pool.WriteBacklog(fileName + "-backlog.csv"); err != nil {
+			return err
+		}
+	}
+	if u.expiry != nil {
+		if err := u.expiry.writeExpiry(fileName + "-expiry.csv"); err != nil {
+			return err
+		}
+	}
+	if u.capacity == nil {
+		return nil
 	}
-	u.DeleteAllInBucket(ctx, pf...)
+	return u.capacity.writeCapacity(fileName + "-capacity.csv")
 }
@@ -0,0 +1,113 @@
+// 场景：视频监控 - 多组视频场景文件
+package video
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"gopkg.in/yaml.v3"
+)
+
+// ChannelGroup 一组参数相同的视频，未指定的参数沿用命令行参数
+type ChannelGroup struct {
+	Name         string  `json:"name" yaml:"name"`                   // 组名
+	ChannelNum   int     `json:"channel_num" yaml:"channel_num"`     // 视频路数
+	BitStream    float32 `json:"bitstream" yaml:"bitstream"`         // 码流大小，单位 Mbps
+	ObjSize      string  `json:"obj_size" yaml:"obj_size"`           // 对象大小，如 128MiB；为空时使用源文件大小
+	LocalPath    string  `json:"local_path" yaml:"local_path"`       // 源文件路径
+	Segments     int     `json:"segments" yaml:"segments"`           // 追加写模式下，一个对象追加分片次数
+	DataLife     float32 `json:"datalife" yaml:"datalife"`           // 数据保留期限，单位 天；0表示与其他未指定的组平分剩余安全容量
+	BucketPrefix string  `json:"bucket_prefix" yaml:"bucket_prefix"` // 桶名前缀
+
+	EventRate       float32 `json:"event_rate" yaml:"event_rate"`             // 移动侦测事件频率，每小时平均事件数
+	EventDuration   float32 `json:"event_duration" yaml:"event_duration"`     // 事件平均时长，单位：秒
+	EventMultiplier float32 `json:"event_multiplier" yaml:"event_multiplier"` // 事件期间码流倍数
+	MotionOnly      *bool   `json:"motion_only" yaml:"motion_only"`           // 仅在事件期间录像
+}
+
+// Scenario 场景文件：多组不同码流、对象大小、保留期限的视频
+type Scenario struct {
+	Groups []ChannelGroup `json:"groups" yaml:"groups"`
+}
+
+// LoadScenario 读取场景文件，.yaml/.yml 按 YAML 解析，其他按 JSON 解析
+func LoadScenario(path string) (*Scenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sc Scenario
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &sc)
+	default:
+		err = json.Unmarshal(b, &sc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse scenario file %s: %w", path, err)
+	}
+	if len(sc.Groups) == 0 {
+		return nil, fmt.Errorf("scenario file %s: no channel groups", path)
+	}
+	for i, g := range sc.Groups {
+		if g.ChannelNum <= 0 {
+			return nil, fmt.Errorf("scenario file %s: group %d: channel_num must be greater than 0", path, i)
+		}
+		if g.ObjSize != "" {
+			if _, err := humanize.ParseBytes(g.ObjSize); err != nil {
+				return nil, fmt.Errorf("scenario file %s: group %d: invalid obj_size %q: %w", path, i, g.ObjSize, err)
+			}
+		}
+	}
+	return &sc, nil
+}
+
+// Apply 按场景文件生成各组视频的需求信息，未指定的参数沿用 v
+func (sc *Scenario) Apply(v *VideoInfo) {
+	v.Groups = v.Groups[:0]
+	for i, g := range sc.Groups {
+		gi := *v
+		gi.Groups = nil
+		gi.GroupName = g.Name
+		if gi.GroupName == "" {
+			gi.GroupName = fmt.Sprintf("group%d", i)
+		}
+		gi.ChannelNum = g.ChannelNum
+		gi.PrepareChannelNum = 0
+		if g.BitStream > 0 {
+			gi.BitStream = g.BitStream
+		}
+		if g.LocalPath != "" {
+			gi.FileInfo.FullPath = g.LocalPath
+		}
+		if g.ObjSize != "" {
+			size, _ := humanize.ParseBytes(g.ObjSize)
+			gi.FileInfo.Size = size
+			gi.FileInfo.SizeHuman = humanize.IBytes(size)
+		}
+		if g.Segments > 0 {
+			gi.Segments = g.Segments
+		}
+		gi.DataLife = g.DataLife
+		if g.BucketPrefix != "" {
+			gi.BucketPrefix = g.BucketPrefix
+		}
+		if g.EventRate > 0 {
+			gi.EventRate = g.EventRate
+		}
+		if g.EventDuration > 0 {
+			gi.EventDuration = g.EventDuration
+		}
+		if g.EventMultiplier > 0 {
+			gi.EventMultiplier = g.EventMultiplier
+		}
+		if g.MotionOnly != nil {
+			gi.MotionOnly = *g.MotionOnly
+		}
+		v.Groups = append(v.Groups, gi)
+	}
+}
@@ -0,0 +1,78 @@
+package video
+
+import (
+	"os"
+	"path/filepath"
+	"stress/pkg/logger"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestScenarioGroups(t *testing.T) {
+	logger.Logger = zap.NewNop().Sugar()
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	err := os.WriteFile(path, []byte(`
+groups:
+  - name: main-stream
+    channel_num: 2
+    bitstream: 8
+    obj_size: 64MiB
+    datalife: 1
+    bucket_prefix: main
+  - name: sub-stream
+    channel_num: 4
+    bitstream: 2
+    obj_size: 16MiB
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := LoadScenario(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := VideoInfo{
+		VideoBaseInfo: VideoBaseInfo{
+			BitStream:      4,
+			TotalCapacity:  1 << 40,
+			SafeWaterLevel: 1,
+		},
+		VideoCustomizeInfo: VideoCustomizeInfo{BucketPrefix: "bucket", ObjPrefix: "data", ObjIdxWidth: 3},
+	}
+	sc.Apply(&v)
+	if err := v.CalcData(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.ChannelNum != 6 || v.BucketNum != 6 {
+		t.Fatalf("channels: got %d, buckets: got %d, want 6", v.ChannelNum, v.BucketNum)
+	}
+	if v.BandWidth != 2+1 {
+		t.Errorf("bandwidth: got %v, want 3", v.BandWidth)
+	}
+	main, sub := v.Groups[0], v.Groups[1]
+	// 每路 1MiB/s，保留 1 天，64MiB 一个对象
+	if main.ObjNum != 2700 || main.ObjNumPC != 1350 {
+		t.Errorf("main stream objects: got %d/%d", main.ObjNum, main.ObjNumPC)
+	}
+	if main.TimeInterval != 64 || sub.TimeInterval != 64 {
+		t.Errorf("intervals: got %v/%v", main.TimeInterval, sub.TimeInterval)
+	}
+	if v.ObjNum != main.ObjNum+sub.ObjNum || uint64(sub.ObjNum)*16<<20 > v.SafeWaterCapacity {
+		t.Errorf("total objects: got %d", v.ObjNum)
+	}
+
+	vc := VideoWorkflow{VideoInfo: v}
+	channels := vc.NewChannels()
+	if len(channels) != 6 {
+		t.Fatalf("got %d channels", len(channels))
+	}
+	if channels[1].ChannelName != "main1" || channels[2].ChannelName != "bucket2" || channels[2].GroupIdx != 1 {
+		t.Errorf("channel 1: %s, channel 2: %s (group %d)", channels[1].ChannelName, channels[2].ChannelName, channels[2].GroupIdx)
+	}
+	if channels[5].ObjNumPC != sub.ObjNumPC {
+		t.Errorf("channel 5 keeps %d objects, want %d", channels[5].ObjNumPC, sub.ObjNumPC)
+	}
+}
@@ -0,0 +1,241 @@
+// 场景：视频监控 - 写入调度
+package video
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"strconv"
+	. "stress/pkg/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// channelQueueSize 每路视频的任务队列长度，队列满时按码流产生的新任务等待入队
+const channelQueueSize = 1024
+
+// Task 一路视频中的一个待处理任务：写入一个对象或追加写的一个分片
+type Task struct {
+	Ready  <-chan struct{} // 关闭后才开始处理，用于保证同一对象的分片按顺序写入，可为空
+	Run    func()          // 处理任务
+	Cancel func()          // 运行结束时任务尚未处理，可为空
+}
+
+func (t Task) cancel() {
+	if t.Cancel != nil {
+		t.Cancel()
+	}
+}
+
+// Pool 写入调度：每路视频一个有界任务队列和最多 MaxWorkers 个处理协程，
+// 所有视频共享全局并发上限。写入慢于码流时任务在队列中积压
+type Pool struct {
+	global chan struct{} // 全局并发上限，为空表示不限制
+
+	mu     sync.Mutex
+	queues []*ChannelQueue
+}
+
+// NewPool 创建写入调度，globalCap 小于等于0表示不限制全局并发
+func NewPool(globalCap int) *Pool {
+	p := &Pool{}
+	if globalCap > 0 {
+		p.global = make(chan struct{}, globalCap)
+	}
+	return p
+}
+
+// ChannelQueue 一路视频的任务队列
+type ChannelQueue struct {
+	vc      *VideoWorkflow
+	tasks   chan Task
+	wg      sync.WaitGroup
+	workers int
+
+	produced   int64
+	completed  int64
+	maxBacklog int64
+	dropped    int64 // 运行结束时队列中未处理的任务数
+}
+
+// Channel 为一路视频启动 MaxWorkers 个处理协程，ctx 结束后停止处理
+func (p *Pool) Channel(ctx context.Context, vc *VideoWorkflow) *ChannelQueue {
+	q := &ChannelQueue{
+		vc:      vc,
+		tasks:   make(chan Task, channelQueueSize),
+		workers: vc.MaxWorkers,
+	}
+	if q.workers < 1 {
+		q.workers = 1
+	}
+	p.mu.Lock()
+	p.queues = append(p.queues, q)
+	p.mu.Unlock()
+	q.wg.Add(q.workers)
+	for i := 0; i < q.workers; i++ {
+		go func() {
+			defer q.wg.Done()
+			for {
+				var t Task
+				select {
+				case <-ctx.Done():
+					return
+				case t = <-q.tasks:
+				}
+				if t.Ready != nil {
+					select {
+					case <-ctx.Done():
+						t.cancel()
+						return
+					case <-t.Ready:
+					}
+				}
+				if !p.acquire(ctx) {
+					t.cancel()
+					return
+				}
+				t.Run()
+				p.release()
+				atomic.AddInt64(&q.completed, 1)
+			}
+		}()
+	}
+	return q
+}
+
+func (p *Pool) acquire(ctx context.Context) bool {
+	if p.global == nil {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case p.global <- struct{}{}:
+		return true
+	}
+}
+
+func (p *Pool) release() {
+	if p.global != nil {
+		<-p.global
+	}
+}
+
+// Submit 任务入队，队列满时等待；ctx 结束时放弃任务并返回 false
+func (q *ChannelQueue) Submit(ctx context.Context, t Task) bool {
+	// 入队前已在排队的任务数，空闲的处理协程会立即取走新任务
+	backlog := int64(len(q.tasks))
+	select {
+	case <-ctx.Done():
+		t.cancel()
+		return false
+	case q.tasks <- t:
+	}
+	atomic.AddInt64(&q.produced, 1)
+	for {
+		cur := atomic.LoadInt64(&q.maxBacklog)
+		if backlog <= cur || atomic.CompareAndSwapInt64(&q.maxBacklog, cur, backlog) {
+			break
+		}
+	}
+	return true
+}
+
+// Backlog 排队等待处理的任务数
+func (q *ChannelQueue) Backlog() int {
+	return len(q.tasks)
+}
+
+// Wait 等待处理协程退出，并取消队列中剩余的任务。须在 ctx 结束、不再 Submit 后调用
+func (q *ChannelQueue) Wait() {
+	q.wg.Wait()
+	for {
+		select {
+		case t := <-q.tasks:
+			t.cancel()
+			atomic.AddInt64(&q.dropped, 1)
+		default:
+			return
+		}
+	}
+}
+
+// Backlog 所有视频排队等待处理的任务数、有积压的视频路数，以及积压最多的一路视频
+func (p *Pool) Backlog() (total, channels int, worst *ChannelQueue) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, q := range p.queues {
+		n := q.Backlog()
+		if n == 0 {
+			continue
+		}
+		total += n
+		channels++
+		if worst == nil || n > worst.Backlog() {
+			worst = q
+		}
+	}
+	return total, channels, worst
+}
+
+// Monitor 每隔 interval 检查一次积压，有积压时输出告警，直到 ctx 结束
+func (p *Pool) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		total, channels, worst := p.Backlog()
+		if total == 0 {
+			continue
+		}
+		Logger.Warnf("Backlog:%d tasks queued in %d channels, uploads slower than bitstream; worst %s: %d queued, %d workers",
+			total, channels, worst.vc.ChannelName, worst.Backlog(), worst.workers)
+	}
+}
+
+// WriteBacklog 将每路视频的任务数及最大积压写入 CSV 文件，并输出汇总
+func (p *Pool) WriteBacklog(fileName string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.queues) == 0 {
+		return nil
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"channel_id", "channel_name", "workers", "produced", "completed", "max_backlog", "dropped"})
+	var backlogged int
+	var maxBacklog int64
+	for _, q := range p.queues {
+		m := atomic.LoadInt64(&q.maxBacklog)
+		w.Write([]string{
+			strconv.Itoa(q.vc.ChannelID),
+			q.vc.ChannelName,
+			strconv.Itoa(q.workers),
+			strconv.FormatInt(atomic.LoadInt64(&q.produced), 10),
+			strconv.FormatInt(atomic.LoadInt64(&q.completed), 10),
+			strconv.FormatInt(m, 10),
+			strconv.FormatInt(atomic.LoadInt64(&q.dropped), 10),
+		})
+		if m > 0 {
+			backlogged++
+		}
+		if m > maxBacklog {
+			maxBacklog = m
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	Logger.Infof("Backlog:%d of %d channels had queued tasks, max backlog %d, written to %s", backlogged, len(p.queues), maxBacklog, fileName)
+	return nil
+}
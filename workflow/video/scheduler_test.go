@@ -0,0 +1,73 @@
+package video
+
+import (
+	"context"
+	"stress/pkg/logger"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestPool(t *testing.T) {
+	logger.Logger = zap.NewNop().Sugar()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPool(3)
+	var running, peak int32
+	var mu sync.Mutex
+	var channels []*VideoWorkflow
+	var queues []*ChannelQueue
+	release := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		vc := &VideoWorkflow{ChannelID: i}
+		vc.MaxWorkers = 2
+		channels = append(channels, vc)
+		queues = append(queues, p.Channel(ctx, vc))
+	}
+	for i, q := range queues {
+		vc := channels[i]
+		for idx := 0; idx < 4; idx++ {
+			idx := idx
+			q.Submit(ctx, Task{Run: func() {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					cur := atomic.LoadInt32(&peak)
+					if n <= cur || atomic.CompareAndSwapInt32(&peak, cur, n) {
+						break
+					}
+				}
+				<-release
+				atomic.AddInt32(&running, -1)
+				mu.Lock()
+				// 每路视频两个处理协程，对象乱序完成
+				vc.Written(3 - idx)
+				mu.Unlock()
+			}})
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if total, _, _ := p.Backlog(); total == 0 {
+		t.Error("want backlog while uploads are blocked")
+	}
+	close(release)
+	for _, q := range queues {
+		for atomic.LoadInt64(&q.completed) < 4 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	cancel()
+	for _, q := range queues {
+		q.Wait()
+	}
+	if peak > 3 {
+		t.Errorf("want at most 3 concurrent tasks, got %d", peak)
+	}
+	for _, vc := range channels {
+		if vc.IdxNext != 4 {
+			t.Errorf("channel %d: want IdxNext 4, got %d", vc.ChannelID, vc.IdxNext)
+		}
+	}
+}
@@ -3,13 +3,18 @@ package video
 import (
 	"fmt"
 	"stress/pkg/utils"
-	"sync"
 	"time"
 )
 
+// 数据保留方式
 const (
-	// 定义一个开始日期字符串
-	dateString = "2023-1-1"
+	RetentionClient    = "client"    // 客户端按保留期限删除最早的对象
+	RetentionLifecycle = "lifecycle" // 桶生命周期规则按保留期限过期，客户端不删除
+)
+
+const (
+	// DefaultSimStart 默认模拟起始日期
+	DefaultSimStart = "2023-01-01"
 	// 定义日期的格式
 	layout = "2006-01-02"
 )
@@ -17,17 +22,45 @@ const (
 // Put benchmarks upload speed.
 type VideoWorkflow struct {
 	VideoInfo
-	ChannelID         int    // 视频ID
-	ChannelName       string // 视频Name
-	SkipStageInit     bool   //跳过init阶段
-	WriteOnly         bool   //只写
-	DeleteImmediately bool   // 立即删除
-	SingleRoot        bool   // 单桶模式
-	SingleRootName    string // 单桶名称
-	Duration          int    // 指定运行时间
+	ChannelID         int           // 视频ID
+	ChannelName       string        // 视频Name
+	SkipStageInit     bool          //跳过init阶段
+	SkipStagePrefill  bool          // 跳过数据预埋阶段
+	WriteOnly         bool          //只写
+	DeleteImmediately bool          // 立即删除
+	SingleRoot        bool          // 单桶模式
+	SingleRootName    string        // 单桶名称
+	Duration          int           // 指定运行时间
+	Resume            bool          // 从状态文件断点续跑
+	StateFile         string        // 状态文件路径
+	StateInterval     time.Duration // 状态文件保存间隔
+	VerifyPct         float64       // 读回校验抽样百分比，0表示不校验
+	VerifyDelay       time.Duration // 写入后延迟再次读回校验的时间，0表示只立即校验一次
+	CapacityInterval  time.Duration // 容量采样间隔，0表示不监控
+	CapacitySource    string        // 容量统计来源：usage/list
+	CapacityAction    string        // 超过安全水位后的处理方式：skip/delete
+	PlaybackReaders   int           // 回放读并发数，0表示不回放
+	PlaybackLivePct   float64       // 回放读中直播回放（读最新写入对象）的百分比，其余为历史回放
+	PlaybackObjects   int           // 每次回放连续读取的对象数
+	PlaybackRange     int64         // 回放时每次范围读取的大小
+	Retention         string        // 数据保留方式：client/lifecycle
+	ExpiryInterval    time.Duration // 生命周期过期检查间隔，0表示不检查
+	LockMode          string        // 对象锁定保留模式：GOVERNANCE/COMPLIANCE，为空表示不设置保留
+	LegalHoldPct      float64       // 设置合法保留的对象百分比
 
 	Depth int // 目录深度，默认1
 
+	Clock *SimClock // 模拟时钟，所有视频共用；为空时对象日期从 DefaultSimStart 开始、不加速
+
+	GroupIdx int // 所属视频组序号，场景文件中的顺序
+
+	// 单路视频运行状态
+	IdxNext   int // 下一个待写入对象序号
+	IdxOldest int // 最早一个未删除对象序号
+
+	start time.Time // 第0个对象所在日期，断点续跑时按状态文件恢复；为空时为模拟时钟的 Start
+
+	written map[int]struct{} // 已乱序写入完成、序号大于 IdxNext 的对象
 }
 
 // calc_date_string 计算日期下一天
@@ -40,9 +73,6 @@ func (u *VideoWorkflow) calc_date_string(startDate string, dateStep int) string
 }
 
 func (u *VideoWorkflow) calc_obj_prefix(objPrefix string, depth int, datePrefix string) string {
-	if datePrefix == "today" {
-		datePrefix = time.Now().Format(layout) + "/"
-	}
 	nestedPrefix := ""
 	for d := 1; d < depth; d++ {
 		nestedPrefix += fmt.Sprintf("nested%d/", d)
@@ -50,55 +80,134 @@ func (u *VideoWorkflow) calc_obj_prefix(objPrefix string, depth int, datePrefix
 	return datePrefix + nestedPrefix + objPrefix + fmt.Sprintf("-ch%d", u.ChannelID)
 }
 
-// Calc_obj_path 计算对象path
-func (u *VideoWorkflow) Calc_obj_path(idx int) string {
-	dateStep := idx / u.ObjNumPCPD
-	datePrefix := u.calc_date_string(dateString, dateStep) + "/"
-	filePrefix := u.calc_obj_prefix(u.ObjPrefix, u.Depth, datePrefix)
-	filePath := filePrefix + utils.Zfill(fmt.Sprint(idx), u.ObjIdxWidth) // + file_type
-	if u.SingleRoot {
-		filePath = fmt.Sprintf("%s/%s", u.ChannelName, filePath)
+// NewChannel 复制当前配置，生成第 id 路视频的 Workflow
+func (u *VideoWorkflow) NewChannel(id int) *VideoWorkflow {
+	vc := *u
+	vc.ChannelID = id
+	vc.ChannelName = fmt.Sprintf("%s%d", u.BucketPrefix, id)
+	vc.IdxNext = u.ObjIdxStart
+	vc.IdxOldest = u.ObjIdxStart
+	return &vc
+}
+
+// NewChannels 生成所有视频：多组视频场景下，各组视频使用各自的数据模型，视频ID全局连续
+func (u *VideoWorkflow) NewChannels() []*VideoWorkflow {
+	if len(u.Groups) == 0 {
+		channels := make([]*VideoWorkflow, u.ChannelNum)
+		for i := range channels {
+			channels[i] = u.NewChannel(i)
+		}
+		return channels
 	}
+	var channels []*VideoWorkflow
+	for gi, info := range u.Groups {
+		g := *u
+		g.VideoInfo = info
+		g.GroupIdx = gi
+		for i := 0; i < info.ChannelNum; i++ {
+			channels = append(channels, g.NewChannel(len(channels)))
+		}
+	}
+	return channels
+}
 
-	return filePath
+// NextDelete 写入一个对象后，返回需要删除的最早对象序号：
+// 每路视频保留 ObjNumPC 个对象（安全水位），超出后每写一个删除最早的一个；
+// WriteOnly 模式不删除，DeleteImmediately 模式只保留最新写入的一个。
+// 删除完成后需调用 Deleted 更新 IdxOldest
+func (u *VideoWorkflow) NextDelete() (int, bool) {
+	if u.WriteOnly {
+		return 0, false
+	}
+	keep := u.ObjNumPC
+	if u.DeleteImmediately || keep < 1 {
+		keep = 1
+	}
+	if u.IdxNext-u.IdxOldest <= keep {
+		return 0, false
+	}
+	return u.IdxOldest, true
 }
 
-// Producer
-func (u *VideoWorkflow) Producer(ch chan int, count int, wg *sync.WaitGroup) {
-	defer close(ch)
-	wg.Add(count)
-	for i := 0; i < count; i++ {
-		ch <- i
-		fmt.Println("任务", i, "生产完毕")
+// Written 第 idx 个对象写入结束（成功或失败）。并行写入时对象可能乱序完成，
+// IdxNext 只推进到连续完成的位置
+func (u *VideoWorkflow) Written(idx int) {
+	if idx != u.IdxNext {
+		if u.written == nil {
+			u.written = make(map[int]struct{})
+		}
+		u.written[idx] = struct{}{}
+		return
 	}
+	u.IdxNext++
+	for {
+		if _, ok := u.written[u.IdxNext]; !ok {
+			break
+		}
+		delete(u.written, u.IdxNext)
+		u.IdxNext++
+	}
+}
+
+// Deleted 第 idx 个对象已删除
+func (u *VideoWorkflow) Deleted(idx int) {
+	u.IdxOldest = idx + 1
 }
 
-// Consumer
-func (u *VideoWorkflow) Consumer(ch chan int, pool chan struct{}, wg *sync.WaitGroup) {
-	for c := range ch {
-		pool <- struct{}{}
-		<-pool
-		go u.Worker(c, wg)
+// clock 返回模拟时钟
+func (u *VideoWorkflow) clock() *SimClock {
+	if u.Clock == nil {
+		return defaultClock
 	}
+	return u.Clock
 }
 
-// 具体消费逻辑
-func (u *VideoWorkflow) Worker(c int, wg *sync.WaitGroup) {
-	defer wg.Done()
-	fmt.Println("任务", c, "消费完毕")
-}
-
-func (u *VideoWorkflow) StageMain() {
-	//初始化管道来接收任务数据
-	ch := make(chan int, 10000)
-	//所有任务执行完毕才结束进程
-	wg := &sync.WaitGroup{}
-	//用来控制协程数量,超过50个会阻塞
-	pool := make(chan struct{}, 50)
-	//任务数量
-	count := 1000
-	go u.Producer(ch, count, wg)
-	u.Consumer(ch, pool, wg)
-	wg.Wait()
-	fmt.Println("任务处理完毕")
+// startDate 返回第0个对象所在日期
+func (u *VideoWorkflow) startDate() time.Time {
+	if !u.start.IsZero() {
+		return u.start
+	}
+	return u.clock().Start
+}
+
+// ObjInterval 一路视频中，每个视频对象产生的实际时间间隔，模拟时钟加速时相应缩短
+func (u *VideoWorkflow) ObjInterval() time.Duration {
+	return u.clock().Real(time.Duration(float64(u.TimeInterval) * float64(time.Second)))
+}
+
+// RealDuration 视频时长 d 对应的实际时间，模拟时钟加速时相应缩短
+func (u *VideoWorkflow) RealDuration(d time.Duration) time.Duration {
+	return u.clock().Real(d)
+}
+
+// Calc_time 计算第 idx 个对象的模拟时间：所在日期加上当天已产生对象的时长
+func (u *VideoWorkflow) Calc_time(idx int) time.Time {
+	t := u.startDate().AddDate(0, 0, idx/u.ObjNumPCPD)
+	return t.Add(time.Duration(float64(idx%u.ObjNumPCPD) * float64(u.TimeInterval) * float64(time.Second)))
+}
+
+// Calc_bucket_name 计算对象所在桶名：单桶模式下所有视频共用一个桶，否则每路视频一个桶
+func (u *VideoWorkflow) Calc_bucket_name() string {
+	if u.SingleRoot {
+		return u.SingleRootName
+	}
+	return u.ChannelName
+}
+
+// Calc_date 计算第 idx 个对象所在的日期
+func (u *VideoWorkflow) Calc_date(idx int) string {
+	dateStep := idx / u.ObjNumPCPD
+	return u.calc_date_string(u.startDate().Format(layout), dateStep)
+}
+
+// Calc_obj_path 计算对象path
+func (u *VideoWorkflow) Calc_obj_path(idx int) string {
+	datePrefix := u.Calc_date(idx) + "/"
+	filePrefix := u.calc_obj_prefix(u.ObjPrefix, u.Depth, datePrefix)
+	filePath := filePrefix + utils.Zfill(fmt.Sprint(idx), u.ObjIdxWidth) // + file_type
+	if u.SingleRoot {
+		filePath = fmt.Sprintf("%s/%s", u.ChannelName, filePath)
+	}
+
+	return filePath
 }
@@ -8,6 +8,7 @@ import (
 	"stress/pkg/bench"
 	"stress/pkg/generator"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/minio/minio-go/v7"
@@ -30,6 +31,35 @@ type Workflow interface {
 	GetCommon() *Common
 }
 
+// Prefiller is implemented by workflows that fill the storage with data
+// after Prepare and before the main workflow is started.
+type Prefiller interface {
+	// Prefill writes the data. The returned operations are saved to a separate result file.
+	// Progress should be reported through Common.PrepareProgress.
+	Prefill(ctx context.Context) (bench.Operations, error)
+}
+
+// Reporter is implemented by workflows that produce results besides the operations,
+// such as time series sampled during the run.
+type Reporter interface {
+	// Report writes the results to files prefixed with fileName.
+	Report(fileName string) error
+}
+
+// StateSaver is implemented by workflows that keep their progress in a state file,
+// so that an interrupted run can be resumed.
+type StateSaver interface {
+	// SaveState writes the current progress.
+	SaveState() error
+}
+
+// PeriodStatuser is implemented by workflows that add their own state,
+// such as the used capacity, to the periodic reports of runs without end time.
+type PeriodStatuser interface {
+	// PeriodStatus returns a single line describing the current state, or an empty string.
+	PeriodStatus() string
+}
+
 // Common contains common workflow parameters.
 type Common struct {
 	S3Client func() (cl *minio.Client, done func())
@@ -68,6 +98,49 @@ type Common struct {
 
 	// ExtraFlags contains extra flags to add to remote clients.
 	ExtraFlags map[string]string
+
+	// Spill writes operations to chunk files while they are collected, if set.
+	Spill *bench.SpillOptions
+
+	// Observers are added to every collector returned by NewCollector.
+	Observers []bench.OpObserver
+
+	// Retry contains the retry policy of each operation type.
+	// Operation types without a policy use the policy of the empty type.
+	Retry map[string]bench.RetryPolicy
+
+	// collector is the last collector returned by NewCollector.
+	// It is created once by RunWorkflow before the workflow runs, so the pointer itself is never changed concurrently.
+	collector *collectorRef
+
+	// abort is the context returned by RequestContext, canceled by abortRequests.
+	abort         context.Context
+	abortRequests context.CancelFunc
+}
+
+// collectorRef holds the last collector returned by NewCollector,
+// so it can be used while the workflow is running.
+type collectorRef struct {
+	mu sync.Mutex
+	c  *bench.Collector
+}
+
+func (r *collectorRef) get() *bench.Collector {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.c
+}
+
+func (r *collectorRef) set(c *bench.Collector) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.c = c
+	r.mu.Unlock()
 }
 
 const (
@@ -84,6 +157,37 @@ func (c *Common) GetCommon() *Common {
 	return c
 }
 
+// RequestContext returns the context of requests. It is not canceled when the benchmark ends,
+// so operations in progress are completed, but only when they do not finish in time after an interrupt.
+func (c *Common) RequestContext() context.Context {
+	if c.abort == nil {
+		return context.Background()
+	}
+	return c.abort
+}
+
+// RetryPolicy returns the retry policy of the operation type.
+func (c *Common) RetryPolicy(opType string) bench.RetryPolicy {
+	if p, ok := c.Retry[opType]; ok {
+		return p
+	}
+	return c.Retry[""]
+}
+
+// NewCollector returns a collector for the workflow operations.
+// When Spill is set the operations are written to chunk files instead of being kept in memory.
+func (c *Common) NewCollector() *bench.Collector {
+	col := bench.NewCollector()
+	if c.Spill != nil {
+		col = bench.NewSpillCollector(*c.Spill)
+	}
+	for _, o := range c.Observers {
+		col.AddObserver(o)
+	}
+	c.collector.set(col)
+	return col
+}
+
 // ErrorF formatted error printer
 func (c *Common) ErrorF(format string, data ...interface{}) {
 	c.Error(fmt.Sprintf(format, data...))
@@ -199,8 +303,8 @@ func (c *Common) DeleteAllInBucket(ctx context.Context, prefixes ...string) {
 	}
 }
 
-// prepareProgress updates preparation progess with the value 0->1.
-func (c *Common) prepareProgress(progress float64) {
+// UpdatePrepareProgress updates preparation progess with the value 0->1.
+func (c *Common) UpdatePrepareProgress(progress float64) {
 	if c.PrepareProgress == nil {
 		return
 	}